@@ -3,9 +3,13 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -16,14 +20,45 @@ type WorkloadAdapter interface {
 	NewObject() client.Object
 	NewObjectList() client.ObjectList
 	ContainerImage(obj client.Object) string
+	PodTemplate(obj client.Object) *corev1.PodTemplateSpec
+	Selector(obj client.Object) *metav1.LabelSelector
 	ComputeVersion(ctx context.Context, c client.Client, obj client.Object, imageTag string) string
+	History(ctx context.Context, c client.Client, obj client.Object) ([]Revision, error)
 	IsReady(obj client.Object) bool
+	Progress(obj client.Object) RolloutProgress
+	RolloutTimes(obj client.Object) (started, completed time.Time)
 	WatchesStatus() bool
 	Spec(obj client.Object) interface{}
 	Status(obj client.Object) interface{}
 	ExtractItems(list client.ObjectList) []client.Object
 }
 
+// RolloutProgress is a kind-neutral view of an in-flight rollout, computed
+// from workload status. Replica counts are pods for DaemonSets.
+type RolloutProgress struct {
+	Desired   int32 // replicas the current spec asks for
+	Updated   int32 // replicas already running the current spec
+	Available int32 // available replicas, old and new
+	Old       int32 // replicas still running a previous spec
+	Observed  bool  // status reflects the current generation
+	// MinAvailable is the fewest available replicas the update strategy
+	// allows: Desired minus maxUnavailable, or Desired for Recreate.
+	MinAvailable int32
+}
+
+// minAvailable resolves maxUnavailable against desired, rounding down like
+// the workload controllers; nil uses def.
+func minAvailable(desired int32, maxUnavailable *intstr.IntOrString, def intstr.IntOrString) int32 {
+	if maxUnavailable == nil {
+		maxUnavailable = &def
+	}
+	n, err := intstr.GetScaledValueFromIntOrPercent(maxUnavailable, int(desired), false)
+	if err != nil {
+		return desired
+	}
+	return max(desired-int32(n), 0)
+}
+
 // --- Deployment adapter ---
 
 type DeploymentAdapter struct{}
@@ -40,6 +75,14 @@ func (DeploymentAdapter) ContainerImage(obj client.Object) string {
 	return ""
 }
 
+func (DeploymentAdapter) PodTemplate(obj client.Object) *corev1.PodTemplateSpec {
+	return &obj.(*appsv1.Deployment).Spec.Template
+}
+
+func (DeploymentAdapter) Selector(obj client.Object) *metav1.LabelSelector {
+	return obj.(*appsv1.Deployment).Spec.Selector
+}
+
 func (DeploymentAdapter) ComputeVersion(
 	ctx context.Context, c client.Client, obj client.Object, imageTag string,
 ) string {
@@ -67,6 +110,34 @@ func (DeploymentAdapter) ComputeVersion(
 	return fmt.Sprintf("gen-%d-img-%s", d.Generation, imageTag)
 }
 
+// History returns the Deployment's ReplicaSets, newest revision first, with
+// the pod-template-hash label stripped so templates compare equal to the spec.
+func (DeploymentAdapter) History(ctx context.Context, c client.Client, obj client.Object) ([]Revision, error) {
+	d := obj.(*appsv1.Deployment)
+	rsList := &appsv1.ReplicaSetList{}
+	if err := c.List(ctx, rsList,
+		client.InNamespace(d.Namespace),
+		client.MatchingLabels(d.Spec.Selector.MatchLabels),
+	); err != nil {
+		return nil, fmt.Errorf("list replicasets: %w", err)
+	}
+	var out []Revision
+	for i := range rsList.Items {
+		rs := &rsList.Items[i]
+		if !metav1.IsControlledBy(rs, d) {
+			continue
+		}
+		number, _ := strconv.ParseInt(rs.Annotations["deployment.kubernetes.io/revision"], 10, 64)
+		tmpl := *rs.Spec.Template.DeepCopy()
+		delete(tmpl.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+		out = append(out, Revision{
+			Name: rs.Name, Number: number, Created: rs.CreationTimestamp.Time, Template: tmpl,
+		})
+	}
+	sortRevisions(out)
+	return out, nil
+}
+
 func (DeploymentAdapter) IsReady(obj client.Object) bool {
 	d := obj.(*appsv1.Deployment)
 	desired := int32(0)
@@ -78,6 +149,48 @@ func (DeploymentAdapter) IsReady(obj client.Object) bool {
 		d.Status.ObservedGeneration == d.Generation
 }
 
+func (DeploymentAdapter) Progress(obj client.Object) RolloutProgress {
+	d := obj.(*appsv1.Deployment)
+	desired := int32(0)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+	floor := desired
+	if d.Spec.Strategy.Type != appsv1.RecreateDeploymentStrategyType {
+		var maxUnavailable *intstr.IntOrString
+		if d.Spec.Strategy.RollingUpdate != nil {
+			maxUnavailable = d.Spec.Strategy.RollingUpdate.MaxUnavailable
+		}
+		floor = minAvailable(desired, maxUnavailable, intstr.FromString("25%"))
+	}
+	return RolloutProgress{
+		Desired:      desired,
+		Updated:      d.Status.UpdatedReplicas,
+		Available:    d.Status.AvailableReplicas,
+		Old:          max(d.Status.Replicas-d.Status.UpdatedReplicas, 0),
+		Observed:     d.Status.ObservedGeneration == d.Generation,
+		MinAvailable: floor,
+	}
+}
+
+// RolloutTimes reads the Progressing condition: the deployment controller
+// stamps it when it creates the new ReplicaSet and when that ReplicaSet
+// becomes available. The Available condition is the fallback for completion.
+func (DeploymentAdapter) RolloutTimes(obj client.Object) (started, completed time.Time) {
+	d := obj.(*appsv1.Deployment)
+	for _, c := range d.Status.Conditions {
+		switch {
+		case c.Type == appsv1.DeploymentProgressing && (c.Reason == "NewReplicaSetCreated" || c.Reason == "FoundNewReplicaSet"):
+			started = c.LastUpdateTime.Time
+		case c.Type == appsv1.DeploymentProgressing && c.Reason == "NewReplicaSetAvailable":
+			completed = c.LastUpdateTime.Time
+		case c.Type == appsv1.DeploymentAvailable && c.Status == corev1.ConditionTrue && completed.IsZero():
+			completed = c.LastTransitionTime.Time
+		}
+	}
+	return started, completed
+}
+
 func (DeploymentAdapter) Spec(obj client.Object) interface{} { return obj.(*appsv1.Deployment).Spec }
 func (DeploymentAdapter) Status(obj client.Object) interface{} {
 	return obj.(*appsv1.Deployment).Status
@@ -108,12 +221,24 @@ func (StatefulSetAdapter) ContainerImage(obj client.Object) string {
 	return ""
 }
 
+func (StatefulSetAdapter) PodTemplate(obj client.Object) *corev1.PodTemplateSpec {
+	return &obj.(*appsv1.StatefulSet).Spec.Template
+}
+
+func (StatefulSetAdapter) Selector(obj client.Object) *metav1.LabelSelector {
+	return obj.(*appsv1.StatefulSet).Spec.Selector
+}
+
 func (StatefulSetAdapter) ComputeVersion(
 	_ context.Context, _ client.Client, obj client.Object, imageTag string,
 ) string {
 	return fmt.Sprintf("gen-%d-img-%s", obj.(*appsv1.StatefulSet).Generation, imageTag)
 }
 
+func (StatefulSetAdapter) History(ctx context.Context, c client.Client, obj client.Object) ([]Revision, error) {
+	return controllerRevisionHistory(ctx, c, obj, obj.(*appsv1.StatefulSet).Spec.Selector)
+}
+
 func (StatefulSetAdapter) IsReady(obj client.Object) bool {
 	s := obj.(*appsv1.StatefulSet)
 	desired := int32(0)
@@ -124,6 +249,37 @@ func (StatefulSetAdapter) IsReady(obj client.Object) bool {
 		s.Status.ObservedGeneration == s.Generation
 }
 
+func (StatefulSetAdapter) Progress(obj client.Object) RolloutProgress {
+	s := obj.(*appsv1.StatefulSet)
+	desired := int32(0)
+	if s.Spec.Replicas != nil {
+		desired = *s.Spec.Replicas
+	}
+	var maxUnavailable *intstr.IntOrString
+	if s.Spec.UpdateStrategy.RollingUpdate != nil {
+		maxUnavailable = s.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable
+	}
+	return RolloutProgress{
+		Desired:      desired,
+		Updated:      s.Status.UpdatedReplicas,
+		Available:    s.Status.ReadyReplicas,
+		Old:          max(s.Status.Replicas-s.Status.UpdatedReplicas, 0),
+		Observed:     s.Status.ObservedGeneration == s.Generation,
+		MinAvailable: minAvailable(desired, maxUnavailable, intstr.FromInt32(1)),
+	}
+}
+
+// RolloutTimes has no start time: StatefulSets record no rollout condition.
+// Completion is the last condition transition, when there is one.
+func (StatefulSetAdapter) RolloutTimes(obj client.Object) (started, completed time.Time) {
+	for _, c := range obj.(*appsv1.StatefulSet).Status.Conditions {
+		if c.LastTransitionTime.After(completed) {
+			completed = c.LastTransitionTime.Time
+		}
+	}
+	return time.Time{}, completed
+}
+
 func (StatefulSetAdapter) Spec(obj client.Object) interface{} { return obj.(*appsv1.StatefulSet).Spec }
 func (StatefulSetAdapter) Status(obj client.Object) interface{} {
 	return obj.(*appsv1.StatefulSet).Status
@@ -154,10 +310,22 @@ func (DaemonSetAdapter) ContainerImage(obj client.Object) string {
 	return ""
 }
 
+func (DaemonSetAdapter) PodTemplate(obj client.Object) *corev1.PodTemplateSpec {
+	return &obj.(*appsv1.DaemonSet).Spec.Template
+}
+
+func (DaemonSetAdapter) Selector(obj client.Object) *metav1.LabelSelector {
+	return obj.(*appsv1.DaemonSet).Spec.Selector
+}
+
 func (DaemonSetAdapter) ComputeVersion(_ context.Context, _ client.Client, obj client.Object, imageTag string) string {
 	return fmt.Sprintf("gen-%d-img-%s", obj.(*appsv1.DaemonSet).Generation, imageTag)
 }
 
+func (DaemonSetAdapter) History(ctx context.Context, c client.Client, obj client.Object) ([]Revision, error) {
+	return controllerRevisionHistory(ctx, c, obj, obj.(*appsv1.DaemonSet).Spec.Selector)
+}
+
 func (DaemonSetAdapter) IsReady(obj client.Object) bool {
 	d := obj.(*appsv1.DaemonSet)
 	return d.Status.NumberAvailable > 0 &&
@@ -165,6 +333,33 @@ func (DaemonSetAdapter) IsReady(obj client.Object) bool {
 		d.Status.ObservedGeneration == d.Generation
 }
 
+func (DaemonSetAdapter) Progress(obj client.Object) RolloutProgress {
+	d := obj.(*appsv1.DaemonSet)
+	var maxUnavailable *intstr.IntOrString
+	if d.Spec.UpdateStrategy.RollingUpdate != nil {
+		maxUnavailable = d.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable
+	}
+	return RolloutProgress{
+		Desired:      d.Status.DesiredNumberScheduled,
+		Updated:      d.Status.UpdatedNumberScheduled,
+		Available:    d.Status.NumberAvailable,
+		Old:          max(d.Status.CurrentNumberScheduled-d.Status.UpdatedNumberScheduled, 0),
+		Observed:     d.Status.ObservedGeneration == d.Generation,
+		MinAvailable: minAvailable(d.Status.DesiredNumberScheduled, maxUnavailable, intstr.FromInt32(1)),
+	}
+}
+
+// RolloutTimes has no start time: DaemonSets record no rollout condition.
+// Completion is the last condition transition, when there is one.
+func (DaemonSetAdapter) RolloutTimes(obj client.Object) (started, completed time.Time) {
+	for _, c := range obj.(*appsv1.DaemonSet).Status.Conditions {
+		if c.LastTransitionTime.After(completed) {
+			completed = c.LastTransitionTime.Time
+		}
+	}
+	return time.Time{}, completed
+}
+
 func (DaemonSetAdapter) Spec(obj client.Object) interface{}   { return obj.(*appsv1.DaemonSet).Spec }
 func (DaemonSetAdapter) Status(obj client.Object) interface{} { return obj.(*appsv1.DaemonSet).Status }
 
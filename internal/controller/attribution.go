@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// AttributionWebhookPath is where the attribution webhook is served.
+const AttributionWebhookPath = "/validate-workload-attribution"
+
+// DefaultAttributionTTL bounds how long a recorded change waits for its rollout.
+const DefaultAttributionTTL = time.Hour
+
+// Attribution is the authenticated user behind a pod template change.
+type Attribution struct {
+	User   string
+	Groups []string
+	Time   time.Time
+}
+
+type attributionKey struct {
+	kind string
+	key  client.ObjectKey
+}
+
+type attributionEntry struct {
+	hash string
+	Attribution
+}
+
+// AttributionStore remembers who last changed the pod template of each
+// workload, keyed by a hash of the template so a rollout is only attributed
+// to the change that produced it. It lives in memory: changes made while the
+// controller was down are not attributed.
+type AttributionStore struct {
+	TTL time.Duration    // 0 uses DefaultAttributionTTL
+	Now func() time.Time // optional; defaults to time.Now
+
+	mu      sync.Mutex
+	entries map[attributionKey]attributionEntry
+}
+
+// Record stores a as the author of tpl on the workload, replacing any
+// earlier change, and drops entries older than the TTL.
+func (s *AttributionStore) Record(kind string, key client.ObjectKey, tpl *corev1.PodTemplateSpec, a Attribution) {
+	if a.Time.IsZero() {
+		a.Time = s.now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries == nil {
+		s.entries = map[attributionKey]attributionEntry{}
+	}
+	for k, e := range s.entries {
+		if s.expired(e) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[attributionKey{kind, key}] = attributionEntry{hash: templateHash(tpl), Attribution: a}
+}
+
+// Lookup returns the author of tpl on the workload, or nil when the change
+// was not observed. A nil store never attributes.
+func (s *AttributionStore) Lookup(kind string, key client.ObjectKey, tpl *corev1.PodTemplateSpec) *Attribution {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[attributionKey{kind, key}]
+	if !ok || s.expired(e) || e.hash != templateHash(tpl) {
+		return nil
+	}
+	a := e.Attribution
+	return &a
+}
+
+func (s *AttributionStore) expired(e attributionEntry) bool {
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = DefaultAttributionTTL
+	}
+	return s.now().Sub(e.Time) > ttl
+}
+
+func (s *AttributionStore) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// templateHash identifies a pod template independently of the object around it.
+func templateHash(tpl *corev1.PodTemplateSpec) string {
+	b, _ := json.Marshal(tpl)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// AttributionWebhook is a validating admission webhook that observes
+// workload UPDATEs in tracked namespaces and records the requesting user of
+// every pod template change in Store. It never denies a request.
+type AttributionWebhook struct {
+	Client   client.Client
+	Adapters []WorkloadAdapter
+	Store    *AttributionStore
+	Decoder  admission.Decoder
+}
+
+// SetupWithManager registers the webhook on the manager's webhook server.
+func (w *AttributionWebhook) SetupWithManager(mgr manager.Manager) {
+	if w.Decoder == nil {
+		w.Decoder = admission.NewDecoder(mgr.GetScheme())
+	}
+	mgr.GetWebhookServer().Register(AttributionWebhookPath, &webhook.Admission{Handler: w})
+}
+
+// Handle records the author of pod template changes and always allows the request.
+func (w *AttributionWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	allowed := admission.Allowed("")
+	if req.Operation != admissionv1.Update {
+		return allowed
+	}
+	var adapter WorkloadAdapter
+	for _, a := range w.Adapters {
+		if strings.EqualFold(a.Kind(), req.Kind.Kind) {
+			adapter = a
+		}
+	}
+	if adapter == nil {
+		return allowed
+	}
+
+	logger := log.FromContext(ctx)
+	oldObj, newObj := adapter.NewObject(), adapter.NewObject()
+	if err := w.Decoder.DecodeRaw(req.OldObject, oldObj); err != nil {
+		logger.Error(err, "Failed to decode old workload", "kind", adapter.Kind())
+		return allowed
+	}
+	if err := w.Decoder.Decode(req, newObj); err != nil {
+		logger.Error(err, "Failed to decode workload", "kind", adapter.Kind())
+		return allowed
+	}
+	tpl := adapter.PodTemplate(newObj)
+	if equality.Semantic.DeepEqual(adapter.PodTemplate(oldObj), tpl) {
+		return allowed
+	}
+
+	var ns corev1.Namespace
+	if err := w.Client.Get(ctx, client.ObjectKey{Name: req.Namespace}, &ns); err != nil {
+		logger.V(1).Info("Cannot check namespace tracking", "namespace", req.Namespace, "error", err.Error())
+		return allowed
+	}
+	if ns.Labels["deployment-annotator"] != "enabled" {
+		return allowed
+	}
+
+	w.Store.Record(adapter.Kind(), client.ObjectKey{Namespace: req.Namespace, Name: req.Name}, tpl, Attribution{
+		User: req.UserInfo.Username, Groups: req.UserInfo.Groups,
+	})
+	logger.V(1).Info("Recorded pod template change", "kind", adapter.Kind(),
+		"name", sanitizeForLog(req.Name), "namespace", sanitizeForLog(req.Namespace),
+		"user", sanitizeForLog(req.UserInfo.Username))
+	return allowed
+}
+
+var _ admission.Handler = (*AttributionWebhook)(nil)
@@ -0,0 +1,128 @@
+//go:build envtest
+
+// Run with a local control plane:
+//
+//	KUBEBUILDER_ASSETS=$(setup-envtest use -p path) go test -tags envtest ./internal/controller/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+func TestAttributionWebhook_EnvTest(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS not set")
+	}
+	path := AttributionWebhookPath
+	ignore := admissionregistrationv1.Ignore
+	none := admissionregistrationv1.SideEffectClassNone
+	env := &envtest.Environment{
+		WebhookInstallOptions: envtest.WebhookInstallOptions{
+			ValidatingWebhooks: []*admissionregistrationv1.ValidatingWebhookConfiguration{{
+				ObjectMeta: metav1.ObjectMeta{Name: "attribution"},
+				Webhooks: []admissionregistrationv1.ValidatingWebhook{{
+					Name:                    "attribution.deployment-annotator.io",
+					AdmissionReviewVersions: []string{"v1"},
+					SideEffects:             &none,
+					FailurePolicy:           &ignore,
+					ClientConfig: admissionregistrationv1.WebhookClientConfig{
+						Service: &admissionregistrationv1.ServiceReference{Path: &path},
+					},
+					Rules: []admissionregistrationv1.RuleWithOperations{{
+						Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Update},
+						Rule: admissionregistrationv1.Rule{
+							APIGroups:   []string{"apps"},
+							APIVersions: []string{"v1"},
+							Resources:   []string{"deployments"},
+						},
+					}},
+				}},
+			}},
+		},
+	}
+	cfg, err := env.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = env.Stop() })
+
+	opts := env.WebhookInstallOptions
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:  testScheme(),
+		Metrics: metricsserver.Options{BindAddress: "0"},
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Host: opts.LocalServingHost, Port: opts.LocalServingPort, CertDir: opts.LocalServingCertDir,
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &AttributionStore{}
+	(&AttributionWebhook{
+		Client:   mgr.GetClient(),
+		Adapters: []WorkloadAdapter{DeploymentAdapter{}},
+		Store:    store,
+	}).SetupWithManager(mgr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = mgr.Start(ctx) }()
+	if !mgr.GetCache().WaitForCacheSync(ctx) {
+		t.Fatal("cache did not sync")
+	}
+
+	admin, err := client.New(cfg, client.Options{Scheme: testScheme()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := deployment("app", "ns", "nginx:1.21", 0)
+	for _, obj := range []client.Object{trackedNamespace("ns"), d} {
+		if err := admin.Create(ctx, obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	userCfg := *cfg
+	userCfg.Impersonate.UserName = "alice"
+	userCfg.Impersonate.Groups = []string{"system:masters"}
+	alice, err := client.New(&userCfg, client.Options{Scheme: testScheme()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The namespace may not be in the webhook's cache yet; retry the change
+	// until it is attributed.
+	deadline := time.Now().Add(30 * time.Second)
+	for image := 22; ; image++ {
+		if err := alice.Get(ctx, client.ObjectKeyFromObject(d), d); err != nil {
+			t.Fatal(err)
+		}
+		d.Spec.Template.Spec.Containers[0].Image = fmt.Sprintf("nginx:1.%d", image)
+		if err := alice.Update(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+		a := store.Lookup("deployment", client.ObjectKeyFromObject(d), &d.Spec.Template)
+		if a != nil {
+			if a.User != "alice" {
+				t.Fatalf("expected alice, got %+v", a)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("pod template change was not attributed")
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func updateRequest(t *testing.T, oldObj, newObj client.Object, user string) admission.Request {
+	t.Helper()
+	oldRaw, err := json.Marshal(oldObj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRaw, err := json.Marshal(newObj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Update,
+		Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		Name:      newObj.GetName(),
+		Namespace: newObj.GetNamespace(),
+		UserInfo:  authenticationv1.UserInfo{Username: user, Groups: []string{"devs"}},
+		OldObject: runtime.RawExtension{Raw: oldRaw},
+		Object:    runtime.RawExtension{Raw: newRaw},
+	}}
+}
+
+func TestAttributionWebhook_RecordsTemplateChanges(t *testing.T) {
+	oldD := deployment("app", "ns", "nginx:1.21", 1)
+	newD := deployment("app", "ns", "nginx:1.22", 2)
+	scaled := deployment("app", "ns", "nginx:1.21", 2)
+	scaled.Spec.Replicas = ptrInt32(3)
+	other := deployment("app", "other", "nginx:1.22", 2)
+
+	_, c := newReconciler([]client.Object{trackedNamespace("ns"), untrackedNamespace("other")}, nil)
+	store := &AttributionStore{}
+	w := &AttributionWebhook{
+		Client:   c,
+		Adapters: []WorkloadAdapter{DeploymentAdapter{}},
+		Store:    store,
+		Decoder:  admission.NewDecoder(testScheme()),
+	}
+	ctx := context.Background()
+
+	for _, req := range []admission.Request{
+		updateRequest(t, oldD, scaled, "bob"),
+		updateRequest(t, oldD, newD, "alice"),
+		updateRequest(t, oldD, other, "mallory"),
+	} {
+		if resp := w.Handle(ctx, req); !resp.Allowed {
+			t.Fatalf("webhook denied %s: %+v", req.UserInfo.Username, resp.Result)
+		}
+	}
+
+	key := client.ObjectKey{Namespace: "ns", Name: "app"}
+	a := store.Lookup("deployment", key, &newD.Spec.Template)
+	if a == nil || a.User != "alice" || !slices.Equal(a.Groups, []string{"devs"}) {
+		t.Fatalf("expected alice to be recorded, got %+v", a)
+	}
+	if a := store.Lookup("deployment", key, &oldD.Spec.Template); a != nil {
+		t.Fatalf("expected no attribution for another template, got %+v", a)
+	}
+	if a := store.Lookup("deployment", client.ObjectKey{Namespace: "other", Name: "app"}, &other.Spec.Template); a != nil {
+		t.Fatalf("expected untracked namespace to be ignored, got %+v", a)
+	}
+}
+
+func TestAttributionStore_Expires(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &AttributionStore{TTL: time.Minute, Now: func() time.Time { return now }}
+	d := deployment("app", "ns", "nginx:1.22", 2)
+	key := client.ObjectKeyFromObject(d)
+	store.Record("deployment", key, &d.Spec.Template, Attribution{User: "alice"})
+
+	now = now.Add(2 * time.Minute)
+	if a := store.Lookup("deployment", key, &d.Spec.Template); a != nil {
+		t.Fatalf("expected attribution to expire, got %+v", a)
+	}
+	if a := (*AttributionStore)(nil).Lookup("deployment", key, &d.Spec.Template); a != nil {
+		t.Fatalf("expected nil store to never attribute, got %+v", a)
+	}
+}
+
+func TestReconcile_VersionChange_AttributesUser(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	d := deployment("app", "ns", "nginx:1.22", 2)
+	d.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.21"}
+	r, _ := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+	r.Lifecycle.Attributions = &AttributionStore{}
+	r.Lifecycle.Attributions.Record("deployment", client.ObjectKeyFromObject(d), &d.Spec.Template,
+		Attribution{User: "alice"})
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	creates := gc.createCalls()
+	if len(creates) != 1 || !slices.Contains(creates[0].tags, "user:alice") {
+		t.Fatalf("expected start annotation tagged user:alice, got %+v", creates)
+	}
+	if !strings.Contains(creates[0].data, "triggered by alice") {
+		t.Fatalf("expected user in text, got %q", creates[0].data)
+	}
+}
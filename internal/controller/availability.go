@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// availabilityDip is an open dip stored in DipAnnotation.
+type availabilityDip struct {
+	start           time.Time
+	lowest, desired int32 // fewest available replicas seen, and the desired count then
+	floor           int32 // MinAvailable when the dip started
+}
+
+func (d availabilityDip) String() string {
+	return fmt.Sprintf("%s,%d,%d,%d", d.start.UTC().Format(time.RFC3339), d.lowest, d.desired, d.floor)
+}
+
+// parseDip decodes DipAnnotation; ok is false when no dip is open.
+func parseDip(value string) (availabilityDip, bool) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return availabilityDip{}, false
+	}
+	start, err := time.Parse(time.RFC3339, parts[0])
+	if err != nil {
+		return availabilityDip{}, false
+	}
+	var n [3]int32
+	for i, p := range parts[1:] {
+		v, err := strconv.ParseInt(p, 10, 32)
+		if err != nil {
+			return availabilityDip{}, false
+		}
+		n[i] = int32(v)
+	}
+	return availabilityDip{start: start, lowest: n[0], desired: n[1], floor: n[2]}, true
+}
+
+// TrackAvailability records availability dips during a rollout: a dip opens
+// when fewer replicas are available than the update strategy allows (see
+// RolloutProgress.MinAvailable) and closes when availability recovers, as a
+// region of its own nested in the rollout, with the lowest availability
+// reached. Dips outside a rollout are not tracked.
+func (l *AnnotationLifecycle) TrackAvailability(
+	ctx context.Context, obj client.Object, kind, imageRef, imageTag string, p RolloutProgress,
+) error {
+	if !l.AvailabilityDips || !p.Observed {
+		return nil
+	}
+	annotations := obj.GetAnnotations()
+	dip, open := parseDip(annotations[DipAnnotation])
+	rolling := annotations[StartAnnotation] != "" && annotations[EndAnnotation] == ""
+	dipping := rolling && p.Available < p.MinAvailable
+
+	switch {
+	case dipping && !open:
+		dip = availabilityDip{start: l.now(), lowest: p.Available, desired: p.Desired, floor: p.MinAvailable}
+	case dipping && p.Available < dip.lowest:
+		dip.lowest, dip.desired = p.Available, p.Desired
+	case !dipping && open:
+		return l.closeDip(ctx, obj, kind, imageRef, imageTag, dip)
+	default:
+		return nil
+	}
+	if err := l.patchAnnotations(ctx, obj, map[string]string{DipAnnotation: dip.String()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to store availability dip")
+		return err
+	}
+	return nil
+}
+
+// closeDip annotates a recovered availability dip as a region ending now.
+func (l *AnnotationLifecycle) closeDip(
+	ctx context.Context, obj client.Object, kind, imageRef, imageTag string, dip availabilityDip,
+) error {
+	logger := log.FromContext(ctx)
+	end := l.now()
+	id, err := l.createOnce(ctx, obj, annotationEvent{
+		obj: obj, kind: kind, name: obj.GetName(), namespace: obj.GetNamespace(),
+		imageRef: imageRef, imageTag: imageTag, eventType: "availability-dip",
+		at: dip.start, end: end, step: dip.start.UTC().Format(time.RFC3339),
+		text: fmt.Sprintf("Availability dip during rollout of %s: %d of %d replicas available at lowest (%d required)",
+			imageRef, dip.lowest, dip.desired, dip.floor),
+		tags: rolloutTags(obj.GetAnnotations()),
+	})
+	if err != nil {
+		logger.Error(err, "Failed to create availability dip annotation")
+		return err
+	}
+	if err := l.patchAnnotations(ctx, obj, map[string]string{DipAnnotation: "", PendingAnnotation: ""}); err != nil {
+		logger.Error(err, "Failed to clear availability dip")
+		return err
+	}
+	logger.Info("Created availability dip annotation", "kind", kind, "annotationID", id,
+		"lowest", dip.lowest, "required", dip.floor, "duration", end.Sub(dip.start))
+	return nil
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcile_AvailabilityDip_AnnotatesLowestAvailability(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := deployment("app", "ns", "nginx:1.22", 2)
+	replicas := int32(4)
+	d.Spec.Replicas = &replicas
+	d.Annotations = map[string]string{VersionAnnotation: "gen-2-img-1.22", StartAnnotation: "100"}
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+	r.Lifecycle.AvailabilityDips = true
+	ctx := context.Background()
+
+	// Default maxUnavailable 25% of 4 allows 3 available replicas.
+	for _, available := range []int32{3, 2, 1, 2, 4} {
+		got := getDeployment(t, c, "app", "ns")
+		got.Status = appsv1.DeploymentStatus{
+			Replicas: 4, UpdatedReplicas: min(available, 4), AvailableReplicas: available, ObservedGeneration: 2,
+		}
+		if err := c.Status().Update(ctx, got); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Reconcile(ctx, reconcileReq("app", "ns")); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(10 * time.Second)
+	}
+
+	var dips []annotationCall
+	for _, call := range gc.createCalls() {
+		if call.what == "deploy-availability-dip:app" {
+			dips = append(dips, call)
+		}
+	}
+	want := "Availability dip during rollout of nginx:1.22: 1 of 4 replicas available at lowest (3 required)"
+	if len(dips) != 1 || dips[0].data != want || !dips[0].at.Equal(now.Add(-40*time.Second)) {
+		t.Fatalf("expected one dip from the first drop, got %+v", dips)
+	}
+	regions := gc.regionCalls()
+	if len(regions) == 0 || regions[0].id != dips[0].id || !regions[0].at.Equal(now.Add(-10*time.Second)) {
+		t.Fatalf("expected the dip to close when availability recovered, got %+v", regions)
+	}
+	if getDeployment(t, c, "app", "ns").Annotations[DipAnnotation] != "" {
+		t.Fatal("expected the dip state to be cleared")
+	}
+}
+
+func TestReconcile_AvailabilityDip_RegionRetriedAfterFailedUpdate(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := deployment("app", "ns", "nginx:1.22", 2)
+	replicas := int32(4)
+	d.Spec.Replicas = &replicas
+	d.Annotations = map[string]string{VersionAnnotation: "gen-2-img-1.22", StartAnnotation: "100"}
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+	r.Lifecycle.AvailabilityDips = true
+	ctx := context.Background()
+	reconcile := func(available int32) error {
+		got := getDeployment(t, c, "app", "ns")
+		got.Status = appsv1.DeploymentStatus{
+			Replicas: 4, UpdatedReplicas: min(available, 4), AvailableReplicas: available, ObservedGeneration: 2,
+		}
+		if err := c.Status().Update(ctx, got); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(10 * time.Second)
+		_, err := r.Reconcile(ctx, reconcileReq("app", "ns"))
+		return err
+	}
+
+	if err := reconcile(1); err != nil {
+		t.Fatal(err)
+	}
+	gc.regionErr = errors.New("grafana unavailable")
+	if err := reconcile(4); err == nil {
+		t.Fatal("expected the failed region update to be returned")
+	}
+	gc.regionErr = nil
+	if err := reconcile(4); err != nil {
+		t.Fatal(err)
+	}
+
+	var dips []annotationCall
+	for _, call := range gc.createCalls() {
+		if call.what == "deploy-availability-dip:app" {
+			dips = append(dips, call)
+		}
+	}
+	if len(dips) != 1 {
+		t.Fatalf("expected one dip annotation, got %+v", dips)
+	}
+	if !slices.ContainsFunc(gc.regionCalls(), func(call annotationCall) bool { return call.id == dips[0].id }) {
+		t.Fatalf("expected the reused dip annotation to become a region, got %+v", gc.regionCalls())
+	}
+	if getDeployment(t, c, "app", "ns").Annotations[DipAnnotation] != "" {
+		t.Fatal("expected the dip state to be cleared")
+	}
+}
+
+func TestProgress_MinAvailable(t *testing.T) {
+	replicas := int32(4)
+	recreate := deployment("app", "ns", "nginx:1.22", 1)
+	recreate.Spec.Replicas = &replicas
+	recreate.Spec.Strategy.Type = appsv1.RecreateDeploymentStrategyType
+	half := intstr.FromString("50%")
+	rolling := deployment("app", "ns", "nginx:1.22", 1)
+	rolling.Spec.Replicas = &replicas
+	rolling.Spec.Strategy.RollingUpdate = &appsv1.RollingUpdateDeployment{MaxUnavailable: &half}
+	sts := &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{Replicas: &replicas}}
+
+	for name, tc := range map[string]struct {
+		got, want int32
+	}{
+		"recreate":          {DeploymentAdapter{}.Progress(recreate).MinAvailable, 4},
+		"rolling 50%":       {DeploymentAdapter{}.Progress(rolling).MinAvailable, 2},
+		"statefulset":       {StatefulSetAdapter{}.Progress(sts).MinAvailable, 3},
+		"daemonset default": {DaemonSetAdapter{}.Progress(&appsv1.DaemonSet{}).MinAvailable, 0},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s: expected %d, got %d", name, tc.want, tc.got)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// backfill annotates the retained history of a workload that is being
+// tracked for the first time, when the lifecycle asks for it. rolling reports
+// that the current revision is still rolling out: it is left out of the
+// backfill, and the caller opens it as a rollout of its own.
+func (r *WorkloadReconciler) backfill(ctx context.Context, obj client.Object, kind string) (rolling bool, err error) {
+	if r.Lifecycle.Backfill <= 0 {
+		return false, nil
+	}
+	history, err := r.Adapter.History(ctx, r.Client, obj)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Cannot read rollout history for backfill", "kind", kind)
+		return false, nil
+	}
+	current := r.Adapter.PodTemplate(obj)
+	var newestEnd time.Time
+	if len(history) > 0 && equality.Semantic.DeepEqual(history[0].Template, *current) {
+		if !r.Adapter.IsReady(obj) {
+			// The previous revision lasted until the rollout in progress started.
+			rolling, newestEnd = true, history[0].Created
+			history = history[1:]
+		} else {
+			_, newestEnd = r.Adapter.RolloutTimes(obj)
+		}
+	}
+	return rolling, r.Lifecycle.BackfillHistory(ctx, obj, kind, history, newestEnd)
+}
+
+// BackfillHistory creates annotations for the newest Backfill revisions in
+// history (newest first), tagged backfill. Each revision is a region from its
+// creation to the creation of the next one; the newest one ends at newestEnd,
+// or is a point when that is unknown. Every annotation carries a key tag per
+// revision, and revisions already annotated in Grafana are skipped, so
+// running it again creates no duplicates.
+func (l *AnnotationLifecycle) BackfillHistory(
+	ctx context.Context, obj client.Object, kind string, history []Revision, newestEnd time.Time,
+) error {
+	logger := log.FromContext(ctx)
+	history = history[:min(l.Backfill, len(history))]
+	created := 0
+	// Oldest first, so annotation IDs follow the rollout order.
+	for i := len(history) - 1; i >= 0; i-- {
+		rev := history[i]
+		key := fmt.Sprintf("backfill:%s/%s/%s", kind, obj.GetNamespace(), rev.Name)
+		found, err := l.GClient.FindAnnotations(ctx, []string{key})
+		if err != nil {
+			logger.Error(err, "Failed to look up backfilled annotation", "revision", rev.Name)
+			return err
+		}
+		if len(found) > 0 {
+			continue
+		}
+
+		var imageRef string
+		if c := rev.Template.Spec.Containers; len(c) > 0 {
+			imageRef = c[0].Image
+		}
+		ev := annotationEvent{
+			obj: obj, kind: kind, name: obj.GetName(), namespace: obj.GetNamespace(),
+			version: fmt.Sprintf("revision-%d", rev.Number), imageRef: imageRef, imageTag: extractImageTag(imageRef),
+			eventType: "backfill", at: rev.Created,
+			text: fmt.Sprintf("Deployed %s (revision %d, backfilled)", imageRef, rev.Number),
+			tags: []string{l.flagTag("origin", "backfill")}, lookupTag: key,
+		}
+		end := newestEnd
+		if i > 0 {
+			end = history[i-1].Created
+		}
+		if end.After(rev.Created) {
+			ev.end = end
+		}
+		if _, err := l.createAnnotation(ctx, ev); err != nil {
+			logger.Error(err, "Failed to create backfill annotation", "revision", rev.Name)
+			return err
+		}
+		created++
+	}
+	if created > 0 {
+		logger.Info("Backfilled rollout history", "kind", kind, "annotations", created)
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// BurstGrouping selects which rollouts are counted together for bursts.
+type BurstGrouping string
+
+const (
+	// BurstGroupCluster counts all rollouts together. It is the default.
+	BurstGroupCluster BurstGrouping = "cluster"
+	// BurstGroupNamespace counts rollouts per namespace.
+	BurstGroupNamespace BurstGrouping = "namespace"
+	// BurstGroupImage counts rollouts per new image reference.
+	BurstGroupImage BurstGrouping = "image"
+)
+
+// DefaultBurstWindow is the aggregation window used when Window is not set.
+const DefaultBurstWindow = 2 * time.Minute
+
+// burstMaxAge bounds how long a burst waits for its slowest member; members
+// still rolling then are listed as such.
+const burstMaxAge = time.Hour
+
+// maxBurstDetails caps the workloads listed in a burst summary.
+const maxBurstDetails = 50
+
+// burstFlushInterval is how often FlushBursts looks for bursts to annotate.
+const burstFlushInterval = time.Minute
+
+// BurstAggregator detects bursts of rollouts: once more than Threshold
+// workloads of a group started within Window, further rollouts of the group
+// join a burst instead of getting start/end annotations of their own. When
+// all members completed, the burst is annotated as one summary region. It
+// lives in memory: a burst open when the controller restarts is not
+// annotated, and its members are annotated on their own when they complete.
+type BurstAggregator struct {
+	Threshold int           // more starts than this within Window form a burst
+	Window    time.Duration // 0 uses DefaultBurstWindow
+	GroupBy   BurstGrouping // empty means BurstGroupCluster
+
+	mu     sync.Mutex
+	groups map[string]*burstGroup
+	bursts map[string]*burst
+	seq    int
+}
+
+type burstGroup struct {
+	starts map[string]time.Time // recent starts by workload key
+	open   *burst
+}
+
+type burstMember struct {
+	kind, namespace, name, imageRef string
+	started, done                   time.Time
+}
+
+func (m *burstMember) key() string {
+	return m.kind + "/" + m.namespace + "/" + m.name
+}
+
+type burst struct {
+	id, group  string
+	start      time.Time
+	individual int // starts in the window annotated before the burst formed
+	members    []*burstMember
+	// annotationID is the summary annotation once created, so a retry after
+	// a failed region update does not create it again.
+	annotationID int64
+}
+
+// groupKey returns the group a rollout is counted in.
+func (b *BurstAggregator) groupKey(m *burstMember) string {
+	switch b.GroupBy {
+	case BurstGroupNamespace:
+		return m.namespace
+	case BurstGroupImage:
+		return m.imageRef
+	default:
+		return ""
+	}
+}
+
+// join records a rollout start and returns the ID of the burst it belongs
+// to, or false when it is annotated on its own. A nil aggregator or a
+// threshold of 0 never aggregates. Joining twice returns the same burst.
+func (b *BurstAggregator) join(m burstMember, now time.Time) (string, bool) {
+	if b == nil || b.Threshold <= 0 {
+		return "", false
+	}
+	window := b.Window
+	if window <= 0 {
+		window = DefaultBurstWindow
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.groups == nil {
+		b.groups = map[string]*burstGroup{}
+		b.bursts = map[string]*burst{}
+	}
+	name := b.groupKey(&m)
+	g := b.groups[name]
+	if g == nil {
+		g = &burstGroup{starts: map[string]time.Time{}}
+		b.groups[name] = g
+	}
+	for k, t := range g.starts {
+		if now.Sub(t) > window {
+			delete(g.starts, k)
+		}
+	}
+	key := m.key()
+	if g.open != nil && slices.ContainsFunc(g.open.members, func(o *burstMember) bool { return o.key() == key }) {
+		return g.open.id, true
+	}
+	g.starts[key] = m.started
+
+	if g.open == nil {
+		if len(g.starts) <= b.Threshold {
+			return "", false
+		}
+		b.seq++
+		g.open = &burst{
+			id:         fmt.Sprintf("%d-%d", now.Unix(), b.seq),
+			group:      name,
+			start:      m.started,
+			individual: len(g.starts) - 1,
+		}
+		for _, t := range g.starts {
+			if t.Before(g.open.start) {
+				g.open.start = t
+			}
+		}
+		b.bursts[g.open.id] = g.open
+	}
+	g.open.members = append(g.open.members, &m)
+	return g.open.id, true
+}
+
+// finish marks a member of burst id as completed at done. It returns false
+// when the burst or the member is unknown, e.g. after a restart.
+func (b *BurstAggregator) finish(id string, m burstMember, done time.Time) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bu := b.bursts[id]
+	if bu == nil {
+		return false
+	}
+	known := false
+	for _, o := range bu.members {
+		if o.key() == m.key() {
+			known = true
+			if o.done.IsZero() {
+				o.done = done
+			}
+		}
+	}
+	return known
+}
+
+// collect removes and returns the bursts whose members all completed, or
+// that waited longer than burstMaxAge.
+func (b *BurstAggregator) collect(now time.Time) []*burst {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []*burst
+	for id, bu := range b.bursts {
+		open := slices.ContainsFunc(bu.members, func(m *burstMember) bool { return m.done.IsZero() })
+		if open && now.Sub(bu.start) < burstMaxAge {
+			continue
+		}
+		delete(b.bursts, id)
+		if g := b.groups[bu.group]; g != nil && g.open == bu {
+			g.open = nil
+		}
+		out = append(out, bu)
+	}
+	return out
+}
+
+// restore puts back a collected burst whose annotation failed, so the next
+// collect returns it again.
+func (b *BurstAggregator) restore(bu *burst) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bursts[bu.id] = bu
+}
+
+// joinBurst records an aggregated rollout: the workload state is reset as by
+// start, without a start annotation, and BurstAnnotation names the burst so
+// CompleteDeployment reports the completion to it.
+func (l *AnnotationLifecycle) joinBurst(
+	ctx context.Context, obj client.Object, kind, version, burstID string, change rolloutChange, startedAt time.Time,
+) error {
+	// The trigger is kept for the annotations the member still gets of its
+	// own, e.g. a timeout or one after a restart lost the burst.
+	trigger := l.provenance(ctx, obj)
+	if change.author != nil {
+		trigger.user = change.author.User
+	}
+	// A member has no start annotation to be sampled under, so the sample of
+	// the rollout it replaces would otherwise never be taken.
+	sampleKey := statsKey(obj, kind)
+	if err := l.patchAnnotations(ctx, obj, map[string]string{
+		StartAnnotation:      "",
+		EndAnnotation:        "",
+		VersionAnnotation:    version,
+		MilestonesAnnotation: "",
+		StartTimeAnnotation:  startedAt.UTC().Format(time.RFC3339),
+		TimedOutAnnotation:   "",
+		ChangeAnnotation:     strings.Join(change.categories, ","),
+		TriggerAnnotation:    strings.Join(trigger.tags(), ","),
+		BurstAnnotation:      burstID,
+		WatchAnnotation:      "",
+	}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to store burst membership")
+		return err
+	}
+	l.stats.take(sampleKey)
+	log.FromContext(ctx).Info("Rollout joined burst", "kind", kind, "burst", burstID, "version", version)
+	l.emitBursts(ctx)
+	return nil
+}
+
+// completeBurstMember reports the completion of an aggregated rollout and
+// annotates the bursts that are finished. A member of a burst that is no
+// longer known, because the controller restarted, is annotated on its own:
+// its rollout is opened at its recorded start and completed.
+func (l *AnnotationLifecycle) completeBurstMember(
+	ctx context.Context, obj client.Object, kind, imageRef, imageTag string, completedAt time.Time,
+) error {
+	annotations := obj.GetAnnotations()
+	startedAt := l.startTime(annotations, maxEventAge)
+	end := l.eventTime(startedAt, completedAt)
+	if !l.Bursts.finish(annotations[BurstAnnotation], burstMember{
+		kind: kind, namespace: obj.GetNamespace(), name: obj.GetName(), imageRef: imageRef,
+	}, end) {
+		log.FromContext(ctx).Info("Burst of rollout unknown, annotating it on its own",
+			"kind", kind, "burst", annotations[BurstAnnotation])
+		var change rolloutChange
+		if v := annotations[ChangeAnnotation]; v != "" {
+			change.categories = strings.Split(v, ",")
+		}
+		if err := l.start(ctx, obj, kind, annotations[VersionAnnotation], imageRef, imageTag, change, startedAt); err != nil {
+			return err
+		}
+		return l.complete(ctx, obj, kind, imageRef, imageTag, completedAt)
+	}
+	patch := map[string]string{BurstAnnotation: ""}
+	l.startWatch(patch, end)
+	l.recordRollout(patch, annotations, RolloutRecord{
+		Version: annotations[VersionAnnotation], Image: imageRef, End: end, Outcome: "completed",
+	})
+	if err := l.patchAnnotations(ctx, obj, patch); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to clear burst membership")
+		return err
+	}
+	l.recordPromotion(ctx, obj, l.resolveImage(ctx, obj, kind, imageRef), end)
+	l.emitBursts(ctx)
+	return nil
+}
+
+// FlushBursts annotates finished and expired bursts every
+// burstFlushInterval until ctx is done, so that a burst waiting on a deleted
+// or stuck member is annotated even when no other rollout happens. It is
+// meant to run as a manager Runnable.
+func (l *AnnotationLifecycle) FlushBursts(ctx context.Context) error {
+	ticker := time.NewTicker(burstFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			l.emitBursts(ctx)
+		}
+	}
+}
+
+// emitBursts annotates every finished burst as one region from the first
+// start in its window to the last completion, or to burstMaxAge after the
+// start when no member completed. A burst whose annotation fails is kept for
+// the next attempt, which only repeats the failed step.
+func (l *AnnotationLifecycle) emitBursts(ctx context.Context) {
+	now := l.now()
+	for _, b := range l.Bursts.collect(now) {
+		var end time.Time
+		var details []string
+		rolling := 0
+		for _, m := range b.members {
+			detail := fmt.Sprintf("%s %s/%s %s", m.kind, m.namespace, m.name, m.imageRef)
+			if m.done.IsZero() {
+				rolling++
+				detail += " still rolling"
+			} else {
+				detail += " in " + m.done.Sub(m.started).Round(time.Second).String()
+				if m.done.After(end) {
+					end = m.done
+				}
+			}
+			details = append(details, detail)
+		}
+		if end.IsZero() {
+			end = b.start.Add(burstMaxAge)
+			if now.Before(end) {
+				end = now
+			}
+		}
+		if len(details) > maxBurstDetails {
+			details = append(details[:maxBurstDetails], fmt.Sprintf("and %d more", len(details)-maxBurstDetails))
+		}
+		text := fmt.Sprintf("Burst of %s", plural(len(b.members), "rollout"))
+		if b.individual > 0 {
+			text += fmt.Sprintf(" (after %d annotated individually)", b.individual)
+		}
+		text += ": " + strings.Join(details, "; ")
+
+		ev := annotationEvent{kind: "burst", name: "cluster", eventType: "burst", at: b.start, end: end, text: text}
+		switch l.Bursts.GroupBy {
+		case BurstGroupNamespace:
+			ev.name, ev.namespace = b.group, b.group
+		case BurstGroupImage:
+			ev.name, ev.imageRef, ev.imageTag = b.group, b.group, extractImageTag(b.group)
+		}
+		if err := l.createBurstAnnotation(ctx, b, ev); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to create burst annotation", "burst", b.id)
+			l.Bursts.restore(b)
+			continue
+		}
+		log.FromContext(ctx).Info("Created burst annotation", "burst", b.id, "annotationID", b.annotationID,
+			"workloads", len(b.members), "stillRolling", rolling)
+	}
+}
+
+// createBurstAnnotation creates the summary of b as a point annotation,
+// unless an earlier attempt did, and ends it as a region at ev.end.
+func (l *AnnotationLifecycle) createBurstAnnotation(ctx context.Context, b *burst, ev annotationEvent) error {
+	end := ev.end
+	ev.end = time.Time{}
+	if b.annotationID == 0 {
+		id, err := l.createAnnotation(ctx, ev)
+		if err != nil {
+			return err
+		}
+		b.annotationID = id
+	}
+	if !end.After(ev.at) {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	return l.GClient.UpdateAnnotationToRegion(ctx, b.annotationID, end, l.renderEvent(ctx, ev).Tags)
+}
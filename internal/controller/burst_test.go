@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcile_Burst_AggregatesRolloutsBeyondThreshold(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	objs := []client.Object{trackedNamespace("ns")}
+	for i := 1; i <= 4; i++ {
+		d := deployment(fmt.Sprintf("app%d", i), "ns", "base:2.0", 2)
+		d.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.0", helmReleaseAnnotation: "shop"}
+		objs = append(objs, d)
+	}
+	r, c := newReconciler(objs, gc)
+	r.Lifecycle.Bursts = &BurstAggregator{Threshold: 2, Window: time.Minute}
+	ctx := context.Background()
+
+	for i := 1; i <= 4; i++ {
+		if _, err := r.Reconcile(ctx, reconcileReq(fmt.Sprintf("app%d", i), "ns")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if creates := gc.createCalls(); len(creates) != 2 {
+		t.Fatalf("expected start annotations for the first two rollouts only, got %+v", creates)
+	}
+	if got := getDeployment(t, c, "app3", "ns"); got.Annotations[BurstAnnotation] == "" ||
+		got.Annotations[VersionAnnotation] != "gen-2-img-2.0" || got.Annotations[TriggerAnnotation] != "trigger:helm" {
+		t.Fatalf("expected app3 to be tracked as a burst member with its trigger, got %v", got.Annotations)
+	}
+
+	for i := 3; i <= 4; i++ {
+		name := fmt.Sprintf("app%d", i)
+		got := getDeployment(t, c, name, "ns")
+		got.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1, ObservedGeneration: 2}
+		if err := c.Status().Update(ctx, got); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Reconcile(ctx, reconcileReq(name, "ns")); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(gc.createCalls()); i == 3 && n != 2 {
+			t.Fatalf("expected the burst to wait for app4, got %d annotations", n)
+		}
+	}
+
+	creates := gc.createCalls()
+	if len(creates) != 3 || !slices.Contains(creates[2].tags, "burst") {
+		t.Fatalf("expected one burst annotation, got %+v", creates)
+	}
+	summary := creates[2].data
+	if !strings.HasPrefix(summary, "Burst of 2 rollouts (after 2 annotated individually)") ||
+		!strings.Contains(summary, "deployment ns/app3 base:2.0 in") || !strings.Contains(summary, "ns/app4") {
+		t.Fatalf("unexpected burst summary %q", summary)
+	}
+	if regions := gc.regionCalls(); len(regions) != 1 || regions[0].id != creates[2].id {
+		t.Fatalf("expected the burst annotation to be a region, got %+v", regions)
+	}
+	if got := getDeployment(t, c, "app4", "ns"); got.Annotations[BurstAnnotation] != "" {
+		t.Fatalf("expected burst membership to be cleared, got %v", got.Annotations)
+	}
+}
+
+func TestBurstAggregator_GroupsAndWindow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := &BurstAggregator{Threshold: 1, Window: time.Minute, GroupBy: BurstGroupNamespace}
+	member := func(ns, name string, at time.Time) burstMember {
+		return burstMember{kind: "deployment", namespace: ns, name: name, started: at}
+	}
+
+	if _, ok := b.join(member("a", "x", now), now); ok {
+		t.Fatal("expected the first rollout to be annotated on its own")
+	}
+	if _, ok := b.join(member("b", "x", now), now); ok {
+		t.Fatal("expected namespaces to be counted separately")
+	}
+	later := now.Add(2 * time.Minute)
+	if _, ok := b.join(member("a", "y", later), later); ok {
+		t.Fatal("expected starts outside the window to be forgotten")
+	}
+	id, ok := b.join(member("a", "z", later), later)
+	if !ok {
+		t.Fatal("expected the second rollout within the window to form a burst")
+	}
+	if again, _ := b.join(member("a", "z", later), later); again != id {
+		t.Fatalf("expected joining twice to return the same burst, got %q and %q", id, again)
+	}
+	if got := b.collect(later); len(got) != 0 {
+		t.Fatalf("expected the burst to wait for its member, got %d", len(got))
+	}
+	if got := b.collect(later.Add(burstMaxAge)); len(got) != 1 {
+		t.Fatalf("expected the burst to be emitted after the maximum age, got %d", len(got))
+	}
+}
+
+func TestReconcile_Burst_UnknownAfterRestartAnnotatesMember(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := readyDeployment("app", "ns", "base:2.0", 2)
+	d.Annotations = map[string]string{
+		VersionAnnotation:   "gen-2-img-2.0",
+		BurstAnnotation:     "1718452800-1",
+		StartTimeAnnotation: now.Add(-5 * time.Minute).Format(time.RFC3339),
+		ChangeAnnotation:    "image",
+	}
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+	r.Lifecycle.Bursts = &BurstAggregator{Threshold: 2}
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	creates := gc.createCalls()
+	if len(creates) != 2 || creates[0].what != "deploy-start:app" || creates[1].what != "deploy-end:app" {
+		t.Fatalf("expected start and end annotations for the orphaned member, got %+v", creates)
+	}
+	if !creates[0].at.Equal(now.Add(-5 * time.Minute)) {
+		t.Fatalf("expected the rollout to start at its recorded start, got %v", creates[0].at)
+	}
+	got := getDeployment(t, c, "app", "ns")
+	if got.Annotations[BurstAnnotation] != "" || got.Annotations[EndAnnotation] == "" {
+		t.Fatalf("expected the rollout to be completed outside the burst, got %v", got.Annotations)
+	}
+}
+
+func TestEmitBursts_FailedAnnotationIsRetried(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	gc := &fakeAnnotationClient{createErr: errors.New("grafana unavailable")}
+	b := &BurstAggregator{Threshold: 1}
+	l := &AnnotationLifecycle{GClient: gc, Bursts: b, Now: func() time.Time { return now }}
+	for _, name := range []string{"x", "y"} {
+		b.join(burstMember{kind: "deployment", namespace: "ns", name: name, started: now}, now)
+	}
+	// The stuck member keeps the burst open until it expires.
+	now = now.Add(burstMaxAge)
+
+	l.emitBursts(context.Background())
+	gc.createErr = nil
+	l.emitBursts(context.Background())
+	if creates := gc.createCalls(); len(creates) != 1 || !strings.Contains(creates[0].data, "still rolling") {
+		t.Fatalf("expected the expired burst to be annotated on the retry, got %+v", creates)
+	}
+}
+
+func TestEmitBursts_FailedRegionUpdateKeepsOneSummary(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	gc := &fakeAnnotationClient{regionErr: errors.New("grafana unavailable")}
+	b := &BurstAggregator{Threshold: 1}
+	l := &AnnotationLifecycle{GClient: gc, Bursts: b, Now: func() time.Time { return now }}
+	for _, name := range []string{"x", "y"} {
+		b.join(burstMember{kind: "deployment", namespace: "ns", name: name, started: start}, start)
+	}
+	// No member completes before the burst expires.
+	now = start.Add(burstMaxAge + time.Minute)
+
+	l.emitBursts(context.Background())
+	gc.regionErr = nil
+	l.emitBursts(context.Background())
+	creates := gc.createCalls()
+	if len(creates) != 1 {
+		t.Fatalf("expected one burst annotation, got %+v", creates)
+	}
+	regions := gc.regionCalls()
+	if len(regions) != 1 || regions[0].id != creates[0].id || !regions[0].at.Equal(start.Add(burstMaxAge)) {
+		t.Fatalf("expected the summary to end at the maximum age on the retry, got %+v", regions)
+	}
+}
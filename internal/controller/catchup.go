@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// catchUpWindow bounds how far back a missed rollout is reconstructed when
+// no earlier rollout of the workload is recorded.
+const catchUpWindow = 24 * time.Hour
+
+// CatchUpDeployment records a rollout that started and finished before the
+// controller saw it, e.g. while the controller was down: the start
+// annotation is placed at the rollout's start time from its revision
+// history and completed at completedAt, both tagged reconstructed.
+// Returns false, without doing anything, when the start time is unknown;
+// the caller then starts the rollout as usual.
+func (l *AnnotationLifecycle) CatchUpDeployment(
+	ctx context.Context, obj client.Object, kind, version, imageRef, imageTag string,
+	change rolloutChange, completedAt time.Time,
+) (bool, error) {
+	startedAt, ok := l.plausibleTime(l.startTime(obj.GetAnnotations(), catchUpWindow), change.startTimes...)
+	if !ok {
+		return false, nil
+	}
+	reconstructed := l.flagTag("origin", "reconstructed")
+	if err := l.start(ctx, obj, kind, version, imageRef, imageTag, change, startedAt, reconstructed); err != nil {
+		return true, err
+	}
+	if err := l.complete(ctx, obj, kind, imageRef, imageTag, completedAt, reconstructed); err != nil {
+		return true, err
+	}
+	log.FromContext(ctx).Info("Reconstructed missed rollout", "kind", kind, "version", version, "startedAt", startedAt)
+	return true, nil
+}
@@ -0,0 +1,312 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Change categories, in the order they are reported.
+const (
+	changeImage      = "image"
+	changeConfig     = "config"
+	changeResources  = "resources"
+	changeProbes     = "probes"
+	changeScheduling = "scheduling"
+	changeRestart    = "restart"
+	changeMetadata   = "metadata"
+	changeOther      = "other"
+)
+
+var changeOrder = []string{
+	changeImage, changeConfig, changeResources, changeProbes,
+	changeScheduling, changeRestart, changeMetadata, changeOther,
+}
+
+// restartedAtAnnotation is set on the pod template by `kubectl rollout restart`.
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// DefaultRedactEnvPatterns are the env var name patterns whose values are
+// never shown in change summaries. Matching is case-insensitive.
+var DefaultRedactEnvPatterns = []string{"*PASSWORD*", "*PASSWD*", "*SECRET*", "*TOKEN*", "*KEY*", "*CREDENTIAL*"}
+
+// maxSummaryLen caps the change summary, in characters, so one rollout cannot produce a huge annotation.
+const maxSummaryLen = 1024
+
+// rolloutChange describes how the pod template of a rollout differs from
+// the previous revision, and who changed it when that is known.
+type rolloutChange struct {
+	categories []string
+	summary    string
+	author     *Attribution // recorded by the attribution webhook
+	// startTimes are candidate rollout start times from Kubernetes, most
+	// precise first; zero entries are unknown.
+	startTimes []time.Time
+}
+
+// describeChange compares the workload's pod template with the most recent
+// different revision in its history. Categories and summary are empty when
+// there is no usable history, e.g. on the first rollout.
+func (r *WorkloadReconciler) describeChange(ctx context.Context, obj client.Object) rolloutChange {
+	current := r.Adapter.PodTemplate(obj)
+	change := rolloutChange{
+		author: r.Lifecycle.Attributions.Lookup(r.Adapter.Kind(), client.ObjectKeyFromObject(obj), current),
+	}
+	started, _ := r.Adapter.RolloutTimes(obj)
+	history, err := r.Adapter.History(ctx, r.Client, obj)
+	change.startTimes = []time.Time{revisionCreated(history, current), started}
+	if err != nil {
+		log.FromContext(ctx).V(1).Info("Cannot read rollout history", "kind", r.Adapter.Kind(), "error", err.Error())
+		return change
+	}
+	prev := previousTemplate(history, current)
+	if prev == nil {
+		return change
+	}
+	change.categories = classifyChange(prev, current)
+	change.summary = summarizeChange(prev, current, r.Lifecycle.redactEnv)
+	return change
+}
+
+// classifyChange returns the categories of change between two pod templates.
+// metadata and restart are only reported when nothing in the pod spec changed.
+func classifyChange(prev, next *corev1.PodTemplateSpec) []string {
+	found := map[string]bool{}
+
+	diffContainers(prev.Spec.InitContainers, next.Spec.InitContainers, found)
+	diffContainers(prev.Spec.Containers, next.Spec.Containers, found)
+	if !equality.Semantic.DeepEqual(prev.Spec.Volumes, next.Spec.Volumes) {
+		found[changeConfig] = true
+	}
+	if !equality.Semantic.DeepEqual(schedulingFields(&prev.Spec), schedulingFields(&next.Spec)) {
+		found[changeScheduling] = true
+	}
+	if !equality.Semantic.DeepEqual(remainingPodSpec(&prev.Spec), remainingPodSpec(&next.Spec)) {
+		found[changeOther] = true
+	}
+
+	if len(found) == 0 {
+		prevAnn, nextAnn := maps.Clone(prev.Annotations), maps.Clone(next.Annotations)
+		if prevAnn[restartedAtAnnotation] != nextAnn[restartedAtAnnotation] {
+			found[changeRestart] = true
+		}
+		delete(prevAnn, restartedAtAnnotation)
+		delete(nextAnn, restartedAtAnnotation)
+		if !equality.Semantic.DeepEqual(prev.Labels, next.Labels) ||
+			!equality.Semantic.DeepEqual(prevAnn, nextAnn) {
+			found[changeMetadata] = true
+		}
+	}
+
+	var out []string
+	for _, c := range changeOrder {
+		if found[c] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// diffContainers matches containers by name and records what changed.
+// Added or removed containers count as "other".
+func diffContainers(prev, next []corev1.Container, found map[string]bool) {
+	if len(prev) != len(next) {
+		found[changeOther] = true
+	}
+	for i := range next {
+		n := &next[i]
+		j := slices.IndexFunc(prev, func(c corev1.Container) bool { return c.Name == n.Name })
+		if j == -1 {
+			found[changeOther] = true
+			continue
+		}
+		p := &prev[j]
+		if p.Image != n.Image {
+			found[changeImage] = true
+		}
+		if !equality.Semantic.DeepEqual(p.Env, n.Env) || !equality.Semantic.DeepEqual(p.EnvFrom, n.EnvFrom) {
+			found[changeConfig] = true
+		}
+		if !equality.Semantic.DeepEqual(p.Resources, n.Resources) {
+			found[changeResources] = true
+		}
+		if !equality.Semantic.DeepEqual(p.LivenessProbe, n.LivenessProbe) ||
+			!equality.Semantic.DeepEqual(p.ReadinessProbe, n.ReadinessProbe) ||
+			!equality.Semantic.DeepEqual(p.StartupProbe, n.StartupProbe) {
+			found[changeProbes] = true
+		}
+		if !equality.Semantic.DeepEqual(remainingContainer(p), remainingContainer(n)) {
+			found[changeOther] = true
+		}
+	}
+}
+
+// remainingContainer clears the container fields that have their own category.
+func remainingContainer(c *corev1.Container) corev1.Container {
+	out := *c.DeepCopy()
+	out.Image = ""
+	out.Env, out.EnvFrom = nil, nil
+	out.Resources = corev1.ResourceRequirements{}
+	out.LivenessProbe, out.ReadinessProbe, out.StartupProbe = nil, nil, nil
+	return out
+}
+
+// schedulingFields extracts the pod spec fields that decide pod placement.
+func schedulingFields(s *corev1.PodSpec) corev1.PodSpec {
+	return corev1.PodSpec{
+		NodeSelector:              s.NodeSelector,
+		NodeName:                  s.NodeName,
+		Affinity:                  s.Affinity,
+		Tolerations:               s.Tolerations,
+		TopologySpreadConstraints: s.TopologySpreadConstraints,
+		PriorityClassName:         s.PriorityClassName,
+		Priority:                  s.Priority,
+		SchedulerName:             s.SchedulerName,
+	}
+}
+
+// remainingPodSpec clears the pod spec fields that have their own category.
+func remainingPodSpec(s *corev1.PodSpec) corev1.PodSpec {
+	out := *s.DeepCopy()
+	out.InitContainers, out.Containers, out.Volumes = nil, nil, nil
+	out.NodeSelector, out.NodeName, out.Affinity = nil, "", nil
+	out.Tolerations, out.TopologySpreadConstraints = nil, nil
+	out.PriorityClassName, out.Priority, out.SchedulerName = "", nil, ""
+	return out
+}
+
+// changeTags returns the change:<category> tags recorded for the current rollout.
+func changeTags(annotations map[string]string) []string {
+	v := annotations[ChangeAnnotation]
+	if v == "" {
+		return nil
+	}
+	var tags []string
+	for _, c := range strings.Split(v, ",") {
+		tags = append(tags, "change:"+c)
+	}
+	return tags
+}
+
+// summarizeChange renders a compact, single-line diff of two pod templates:
+// images, env vars added (+), removed (-) and changed (~), and resource
+// requests/limits, per container. Values of env vars that come from Secrets
+// or whose name satisfies redact are replaced by <redacted>.
+func summarizeChange(prev, next *corev1.PodTemplateSpec, redact func(name string) bool) string {
+	var parts []string
+	for i := range next.Spec.Containers {
+		n := &next.Spec.Containers[i]
+		j := slices.IndexFunc(prev.Spec.Containers, func(c corev1.Container) bool { return c.Name == n.Name })
+		if j == -1 {
+			parts = append(parts, fmt.Sprintf("%s: added %s", n.Name, n.Image))
+			continue
+		}
+		p := &prev.Spec.Containers[j]
+		var diffs []string
+		if p.Image != n.Image {
+			diffs = append(diffs, fmt.Sprintf("image %s → %s", p.Image, n.Image))
+		}
+		if env := summarizeEnv(p.Env, n.Env, redact); env != "" {
+			diffs = append(diffs, "env "+env)
+		}
+		diffs = append(diffs, summarizeResources("request", p.Resources.Requests, n.Resources.Requests)...)
+		diffs = append(diffs, summarizeResources("limit", p.Resources.Limits, n.Resources.Limits)...)
+		if len(diffs) > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %s", n.Name, strings.Join(diffs, ", ")))
+		}
+	}
+	for i := range prev.Spec.Containers {
+		name := prev.Spec.Containers[i].Name
+		if !slices.ContainsFunc(next.Spec.Containers, func(c corev1.Container) bool { return c.Name == name }) {
+			parts = append(parts, fmt.Sprintf("%s: removed", name))
+		}
+	}
+	out := strings.Join(parts, "; ")
+	if r := []rune(out); len(r) > maxSummaryLen {
+		out = string(r[:maxSummaryLen]) + "…"
+	}
+	return out
+}
+
+// summarizeEnv lists env var changes as "+NEW=v -OLD ~CHANGED=a→b".
+func summarizeEnv(prev, next []corev1.EnvVar, redact func(name string) bool) string {
+	prevByName := make(map[string]corev1.EnvVar, len(prev))
+	for _, e := range prev {
+		prevByName[e.Name] = e
+	}
+	var out []string
+	for _, e := range next {
+		old, ok := prevByName[e.Name]
+		switch {
+		case !ok:
+			out = append(out, fmt.Sprintf("+%s=%s", e.Name, envValue(e, redact)))
+		case !equality.Semantic.DeepEqual(old, e):
+			out = append(out, fmt.Sprintf("~%s=%s→%s", e.Name, envValue(old, redact), envValue(e, redact)))
+		}
+		delete(prevByName, e.Name)
+	}
+	for _, name := range slices.Sorted(maps.Keys(prevByName)) {
+		out = append(out, "-"+name)
+	}
+	return strings.Join(out, " ")
+}
+
+// envValue renders an env var value for a summary, hiding anything sensitive.
+func envValue(e corev1.EnvVar, redact func(name string) bool) string {
+	switch {
+	case e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil, redact(e.Name):
+		return "<redacted>"
+	case e.ValueFrom != nil && e.ValueFrom.ConfigMapKeyRef != nil:
+		return fmt.Sprintf("<configmap %s/%s>", e.ValueFrom.ConfigMapKeyRef.Name, e.ValueFrom.ConfigMapKeyRef.Key)
+	case e.ValueFrom != nil:
+		return "<ref>"
+	}
+	return e.Value
+}
+
+// summarizeResources lists quantities that differ, e.g. "cpu request 100m → 200m".
+func summarizeResources(what string, prev, next corev1.ResourceList) []string {
+	names := map[corev1.ResourceName]bool{}
+	for n := range prev {
+		names[n] = true
+	}
+	for n := range next {
+		names[n] = true
+	}
+	var out []string
+	for _, n := range slices.Sorted(maps.Keys(names)) {
+		p, hasP := prev[n]
+		q, hasQ := next[n]
+		if hasP && hasQ && p.Cmp(q) == 0 {
+			continue
+		}
+		from, to := "none", "none"
+		if hasP {
+			from = p.String()
+		}
+		if hasQ {
+			to = q.String()
+		}
+		out = append(out, fmt.Sprintf("%s %s %s → %s", n, what, from, to))
+	}
+	return out
+}
+
+// rolloutTags returns the tags recorded when the current rollout started
+// (change categories and trigger), so every annotation of the rollout
+// carries them.
+func rolloutTags(annotations map[string]string) []string {
+	tags := changeTags(annotations)
+	if v := annotations[TriggerAnnotation]; v != "" {
+		tags = append(tags, strings.Split(v, ",")...)
+	}
+	return tags
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func podTemplate(image string) *corev1.PodTemplateSpec {
+	return &corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:  "main",
+			Image: image,
+			Env:   []corev1.EnvVar{{Name: "LOG_LEVEL", Value: "info"}},
+		}}},
+	}
+}
+
+func TestClassifyChange(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(t *corev1.PodTemplateSpec)
+		want   []string
+	}{
+		{"image", func(t *corev1.PodTemplateSpec) { t.Spec.Containers[0].Image = "app:1.3" }, []string{"image"}},
+		{"env", func(t *corev1.PodTemplateSpec) { t.Spec.Containers[0].Env[0].Value = "debug" }, []string{"config"}},
+		{"resources", func(t *corev1.PodTemplateSpec) {
+			t.Spec.Containers[0].Resources.Requests = corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("100m"),
+			}
+		}, []string{"resources"}},
+		{"probes", func(t *corev1.PodTemplateSpec) {
+			t.Spec.Containers[0].ReadinessProbe = &corev1.Probe{PeriodSeconds: 5}
+		}, []string{"probes"}},
+		{"scheduling", func(t *corev1.PodTemplateSpec) {
+			t.Spec.NodeSelector = map[string]string{"pool": "batch"}
+		}, []string{"scheduling"}},
+		{"restart", func(t *corev1.PodTemplateSpec) {
+			t.Annotations = map[string]string{restartedAtAnnotation: "2025-06-15T12:00:00Z"}
+		}, []string{"restart"}},
+		{"metadata only", func(t *corev1.PodTemplateSpec) {
+			t.Labels = map[string]string{"team": "payments"}
+		}, []string{"metadata"}},
+		{"metadata hidden by spec change", func(t *corev1.PodTemplateSpec) {
+			t.Labels = map[string]string{"team": "payments"}
+			t.Spec.Containers[0].Image = "app:1.3"
+		}, []string{"image"}},
+		{"sidecar added", func(t *corev1.PodTemplateSpec) {
+			t.Spec.Containers = append(t.Spec.Containers, corev1.Container{Name: "proxy", Image: "envoy"})
+		}, []string{"other"}},
+		{"command and image", func(t *corev1.PodTemplateSpec) {
+			t.Spec.Containers[0].Command = []string{"serve"}
+			t.Spec.Containers[0].Image = "app:1.3"
+		}, []string{"image", "other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := podTemplate("app:1.2")
+			next := podTemplate("app:1.2")
+			tt.mutate(next)
+			if got := classifyChange(prev, next); !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarizeChange_RedactsSecrets(t *testing.T) {
+	prev := podTemplate("app:1.2")
+	prev.Spec.Containers[0].Env = append(prev.Spec.Containers[0].Env,
+		corev1.EnvVar{Name: "DB_PASSWORD", Value: "hunter2"},
+		corev1.EnvVar{Name: "OLD_FLAG", Value: "1"},
+	)
+	prev.Spec.Containers[0].Resources.Requests = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}
+	next := podTemplate("app:1.3")
+	next.Spec.Containers[0].Env = []corev1.EnvVar{
+		{Name: "LOG_LEVEL", Value: "debug"},
+		{Name: "DB_PASSWORD", Value: "correct-horse"},
+		{Name: "API", ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{Key: "url"},
+		}},
+	}
+	next.Spec.Containers[0].Resources.Requests = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")}
+
+	l := &AnnotationLifecycle{}
+	got := summarizeChange(prev, next, l.redactEnv)
+	want := "main: image app:1.2 → app:1.3, " +
+		"env ~LOG_LEVEL=info→debug ~DB_PASSWORD=<redacted>→<redacted> +API=<redacted> -OLD_FLAG, " +
+		"cpu request 100m → 200m"
+	if got != want {
+		t.Fatalf("got  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DeletionFinalizer holds a tracked workload until its deletion has been
+// annotated (see AnnotationLifecycle.TrackDeletion).
+const DeletionFinalizer = "deployment-annotator.io/deletion"
+
+// deletionWaitLimit bounds how long a deleting workload is held for its pods
+// to terminate; after that the deletion region is closed anyway.
+const deletionWaitLimit = 10 * time.Minute
+
+// handleFinalizer annotates the deletion of a workload held by
+// DeletionFinalizer: a "deleting" annotation when deletion starts, closed as
+// a region once the workload's pods are gone, after which the finalizer is
+// released. Workloads in untracked namespaces, or with deletion tracking
+// turned off, are released at once; so are workloads of a terminating
+// namespace, which is annotated as a whole (see AnnounceTracking).
+func (r *WorkloadReconciler) handleFinalizer(
+	ctx context.Context, obj client.Object, kind string, ns *corev1.Namespace,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	if !controllerutil.ContainsFinalizer(obj, DeletionFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	if namespaceTerminating(ns) {
+		return ctrl.Result{}, setFinalizer(ctx, r.Client, obj, false)
+	}
+	if ns.Labels["deployment-annotator"] != "enabled" || !r.Lifecycle.TrackDeletion {
+		return ctrl.Result{}, setFinalizer(ctx, r.Client, obj, false)
+	}
+
+	imageRef := r.Adapter.ContainerImage(obj)
+	imageTag := extractImageTag(imageRef)
+	if err := r.Lifecycle.StartDeletion(ctx, obj, kind, imageRef, imageTag); err != nil {
+		return ctrl.Result{RequeueAfter: time.Minute}, err
+	}
+	if r.Lifecycle.now().Sub(obj.GetDeletionTimestamp().Time) < deletionWaitLimit {
+		waiting, err := r.awaitPods(ctx, obj)
+		if err != nil {
+			logger.Error(err, "Failed to check pods of deleting workload", "kind", kind)
+			return ctrl.Result{RequeueAfter: time.Minute}, err
+		}
+		if waiting {
+			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		}
+	} else {
+		logger.Info("Pods still present after deletion wait limit, closing deletion annotation",
+			"kind", kind, "name", sanitizeForLog(obj.GetName()), "namespace", sanitizeForLog(obj.GetNamespace()))
+	}
+	if err := r.Lifecycle.CompleteDeletion(ctx, obj, kind, imageTag); err != nil {
+		return ctrl.Result{RequeueAfter: time.Minute}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// awaitPods reports whether the deleting workload still has pods. An owner
+// held by a finalizer only loses its dependents in foreground deletion, so a
+// background deletion is re-issued as foreground and waited for. Orphaned
+// pods are not waited for.
+func (r *WorkloadReconciler) awaitPods(ctx context.Context, obj client.Object) (bool, error) {
+	if controllerutil.ContainsFinalizer(obj, metav1.FinalizerOrphanDependents) {
+		return false, nil
+	}
+	if !controllerutil.ContainsFinalizer(obj, metav1.FinalizerDeleteDependents) {
+		err := r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationForeground))
+		return err == nil, client.IgnoreNotFound(err)
+	}
+	pods, err := r.listPods(ctx, obj)
+	if err != nil {
+		return false, err
+	}
+	return len(pods) > 0, nil
+}
+
+// StartDeletion creates the "deleting" annotation of a workload being
+// deleted, placed at its deletion timestamp, and stores its ID in
+// DeletingAnnotation. It does nothing once the annotation exists.
+func (l *AnnotationLifecycle) StartDeletion(ctx context.Context, obj client.Object, kind, imageRef, imageTag string) error {
+	if obj.GetAnnotations()[DeletingAnnotation] != "" {
+		return nil
+	}
+	id, err := l.createOnce(ctx, obj, annotationEvent{
+		obj: obj, kind: kind, name: obj.GetName(), namespace: obj.GetNamespace(),
+		imageRef: imageRef, imageTag: imageTag, eventType: "deleting",
+		at: l.eventTime(time.Time{}, obj.GetDeletionTimestamp().Time),
+	})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to create deleting annotation", "kind", kind)
+		return err
+	}
+	if err := l.patchAnnotations(ctx, obj, map[string]string{
+		DeletingAnnotation: strconv.FormatInt(id, 10),
+		PendingAnnotation:  "",
+	}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to store deleting annotation", "kind", kind)
+		return err
+	}
+	log.FromContext(ctx).Info("Created deleting annotation", "kind", kind,
+		"name", sanitizeForLog(obj.GetName()), "namespace", sanitizeForLog(obj.GetNamespace()), "annotationID", id)
+	return nil
+}
+
+// CompleteDeletion closes the deleting annotation as a region ending now
+// (or, in the points style, creates a "deleted" annotation) and releases the
+// finalizer. The deleted annotation RecordDeletion would otherwise create
+// when the object disappears is skipped.
+func (l *AnnotationLifecycle) CompleteDeletion(ctx context.Context, obj client.Object, kind, imageTag string) error {
+	if id := obj.GetAnnotations()[DeletingAnnotation]; id != "" {
+		end := l.now()
+		if l.Style == AnnotationStylePoints {
+			if _, err := l.createOnce(ctx, obj, annotationEvent{
+				obj: obj, kind: kind, name: obj.GetName(), namespace: obj.GetNamespace(),
+				imageTag: imageTag, eventType: "deleted", at: end,
+			}); err != nil {
+				log.FromContext(ctx).Error(err, "Failed to create deletion annotation", "kind", kind)
+				return err
+			}
+		} else if err := l.closeRegion(ctx, obj, kind, imageTag, id, end, l.flagTag("outcome", "deleted")); err != nil {
+			return err
+		}
+	}
+	l.finalized.Store(deletionKey(kind, client.ObjectKeyFromObject(obj)), true)
+	if err := setFinalizer(ctx, l.Client, obj, false); err != nil {
+		l.finalized.Delete(deletionKey(kind, client.ObjectKeyFromObject(obj)))
+		log.FromContext(ctx).Error(err, "Failed to remove deletion finalizer", "kind", kind)
+		return err
+	}
+	log.FromContext(ctx).Info("Annotated workload deletion", "kind", kind,
+		"name", sanitizeForLog(obj.GetName()), "namespace", sanitizeForLog(obj.GetNamespace()))
+	return nil
+}
+
+// finalizedDeletion reports, once, whether the deletion of a workload was
+// already annotated by CompleteDeletion.
+func (l *AnnotationLifecycle) finalizedDeletion(kind string, key client.ObjectKey) bool {
+	_, ok := l.finalized.LoadAndDelete(deletionKey(kind, key))
+	return ok
+}
+
+func deletionKey(kind string, key client.ObjectKey) string {
+	return kind + "/" + key.String()
+}
+
+// syncFinalizer adds DeletionFinalizer to a tracked workload when deletion
+// tracking is on, and removes it when it was turned off.
+func (l *AnnotationLifecycle) syncFinalizer(ctx context.Context, obj client.Object) error {
+	return setFinalizer(ctx, l.Client, obj, l.TrackDeletion)
+}
+
+// setFinalizer adds or removes DeletionFinalizer with an optimistic-lock patch.
+func setFinalizer(ctx context.Context, c client.Client, obj client.Object, present bool) error {
+	if controllerutil.ContainsFinalizer(obj, DeletionFinalizer) == present {
+		return nil
+	}
+	orig := obj.DeepCopyObject().(client.Object)
+	if present {
+		controllerutil.AddFinalizer(obj, DeletionFinalizer)
+	} else {
+		controllerutil.RemoveFinalizer(obj, DeletionFinalizer)
+	}
+	return client.IgnoreNotFound(
+		c.Patch(ctx, obj, client.MergeFromWithOptions(orig, client.MergeFromWithOptimisticLock{})))
+}
+
+// RemoveDeletionFinalizers removes DeletionFinalizer from every workload of
+// the given kinds in the cluster, e.g. before the controller is uninstalled.
+// It returns how many workloads were released.
+func RemoveDeletionFinalizers(ctx context.Context, c client.Client, adapters []WorkloadAdapter) (int, error) {
+	released := 0
+	for _, a := range adapters {
+		list := a.NewObjectList()
+		if err := c.List(ctx, list); err != nil {
+			return released, err
+		}
+		for _, item := range a.ExtractItems(list) {
+			if !controllerutil.ContainsFinalizer(item, DeletionFinalizer) {
+				continue
+			}
+			if err := setFinalizer(ctx, c, item, false); err != nil {
+				return released, err
+			}
+			released++
+		}
+	}
+	return released, nil
+}
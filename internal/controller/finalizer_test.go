@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestReconcile_DeletionFinalizer_AnnotatesDeletionRegion(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	d := readyDeployment("app", "ns", "nginx:1.21", 1)
+	d.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.21"}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: "app-1", Namespace: "ns", Labels: map[string]string{"app": "app"},
+	}}
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d, pod}, gc)
+	r.Lifecycle.TrackDeletion = true
+	ctx := context.Background()
+
+	if _, err := r.Reconcile(ctx, reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	if got := getDeployment(t, c, "app", "ns"); !controllerutil.ContainsFinalizer(got, DeletionFinalizer) {
+		t.Fatalf("expected finalizer to be added, got %v", got.Finalizers)
+	}
+
+	// Simulate a foreground deletion: the garbage collector removes the pods
+	// and the foregroundDeletion finalizer while ours holds the object.
+	held := getDeployment(t, c, "app", "ns")
+	held.Finalizers = append(held.Finalizers, metav1.FinalizerDeleteDependents)
+	if err := c.Update(ctx, held); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, held); err != nil {
+		t.Fatal(err)
+	}
+	res, err := r.Reconcile(ctx, reconcileReq("app", "ns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RequeueAfter == 0 {
+		t.Fatal("expected to wait for the pod to terminate")
+	}
+	creates := gc.createCalls()
+	if len(creates) != 1 || !slices.Contains(creates[0].tags, "deleting") {
+		t.Fatalf("expected a deleting annotation, got %+v", creates)
+	}
+	if len(gc.regionCalls()) != 0 {
+		t.Fatal("expected the region to stay open while pods run")
+	}
+
+	if err := c.Delete(ctx, pod); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	regions := gc.regionCalls()
+	if len(regions) != 1 || regions[0].id != creates[0].id || !slices.Contains(regions[0].tags, "deleted") {
+		t.Fatalf("expected the deleting annotation to become a region, got %+v", regions)
+	}
+	held = getDeployment(t, c, "app", "ns")
+	if !slices.Equal(held.Finalizers, []string{metav1.FinalizerDeleteDependents}) {
+		t.Fatalf("expected the finalizer to be released, got %v", held.Finalizers)
+	}
+	held.Finalizers = nil
+	if err := c.Update(ctx, held); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(d), d); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the deployment to be gone, got %v", err)
+	}
+
+	if _, err := r.Reconcile(ctx, reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	if creates := gc.createCalls(); len(creates) != 1 {
+		t.Fatalf("expected no separate deleted annotation, got %+v", creates)
+	}
+}
+
+func TestReconcile_DeletionWithNamespace_ForgetsFinalizedWorkload(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	r, _ := newReconciler(nil, gc)
+	key := client.ObjectKey{Namespace: "ns", Name: "app"}
+	// CompleteDeletion annotated the workload, then its namespace went away.
+	r.Lifecycle.finalized.Store(deletionKey("deployment", key), true)
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Lifecycle.finalized.Load(deletionKey("deployment", key)); ok {
+		t.Fatal("expected the finalized workload to be forgotten")
+	}
+	if creates := gc.createCalls(); len(creates) != 0 {
+		t.Fatalf("expected no deletion annotation, got %+v", creates)
+	}
+}
+
+func TestMapNamespace_UntrackRemovesFinalizer(t *testing.T) {
+	d := deployment("app", "ns", "nginx:1.21", 1)
+	d.Finalizers = []string{DeletionFinalizer}
+	r, c := newReconciler([]client.Object{untrackedNamespace("ns"), d}, &fakeAnnotationClient{})
+	r.Lifecycle.TrackDeletion = true
+
+	r.mapNamespaceToWorkloads(context.Background(), getNamespace(t, c, "ns"))
+	if got := getDeployment(t, c, "app", "ns"); len(got.Finalizers) != 0 {
+		t.Fatalf("expected finalizer to be removed, got %v", got.Finalizers)
+	}
+}
+
+func TestRemoveDeletionFinalizers(t *testing.T) {
+	held := deployment("held", "a", "nginx:1.21", 1)
+	held.Finalizers = []string{DeletionFinalizer, "example.com/other"}
+	free := deployment("free", "b", "nginx:1.21", 1)
+	_, c := newReconciler([]client.Object{held, free}, nil)
+
+	n, err := RemoveDeletionFinalizers(context.Background(), c, []WorkloadAdapter{DeploymentAdapter{}, StatefulSetAdapter{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected one workload released, got %d", n)
+	}
+	if got := getDeployment(t, c, "held", "a"); !slices.Equal(got.Finalizers, []string{"example.com/other"}) {
+		t.Fatalf("expected only the controller's finalizer to be removed, got %v", got.Finalizers)
+	}
+}
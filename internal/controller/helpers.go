@@ -12,17 +12,28 @@ import (
 // specChangedPredicate triggers on spec changes. When the adapter watches
 // status it also triggers on status changes (used by StatefulSet/DaemonSet
 // which detect completion via their own status, not via a secondary watch).
+// It also triggers when a workload starts deleting, for DeletionFinalizer,
+// and when a Deployment's rollout stalls (see progressStalledAt), which its
+// ReplicaSets do not report.
 func specChangedPredicate(adapter WorkloadAdapter) predicate.Predicate {
 	return predicate.Funcs{
 		CreateFunc:  func(event.CreateEvent) bool { return true },
 		DeleteFunc:  func(event.DeleteEvent) bool { return true },
 		GenericFunc: func(event.GenericEvent) bool { return true },
 		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectOld.GetDeletionTimestamp() == nil && e.ObjectNew.GetDeletionTimestamp() != nil {
+				return true
+			}
 			oldSpec, _ := json.Marshal(adapter.Spec(e.ObjectOld))
 			newSpec, _ := json.Marshal(adapter.Spec(e.ObjectNew))
 			if !bytes.Equal(oldSpec, newSpec) {
 				return true
 			}
+			if _, stalled := progressStalledAt(e.ObjectNew); stalled {
+				if _, was := progressStalledAt(e.ObjectOld); !was {
+					return true
+				}
+			}
 			if !adapter.WatchesStatus() {
 				return false
 			}
@@ -33,7 +44,8 @@ func specChangedPredicate(adapter WorkloadAdapter) predicate.Predicate {
 	}
 }
 
-// namespaceLabelChangedPredicate triggers when the deployment-annotator label toggles.
+// namespaceLabelChangedPredicate triggers when the deployment-annotator label
+// toggles and when a tracked namespace starts terminating.
 func namespaceLabelChangedPredicate() predicate.Predicate {
 	return predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool {
@@ -48,7 +60,8 @@ func namespaceLabelChangedPredicate() predicate.Predicate {
 			}
 			was := oldNs.Labels["deployment-annotator"] == "enabled"
 			now := newNs.Labels["deployment-annotator"] == "enabled"
-			return was != now
+			deleting := oldNs.DeletionTimestamp == nil && newNs.DeletionTimestamp != nil
+			return was != now || (now && deleting)
 		},
 		DeleteFunc:  func(event.DeleteEvent) bool { return false },
 		GenericFunc: func(event.GenericEvent) bool { return false },
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Revision is one retained entry of a workload's rollout history: a
+// ReplicaSet for Deployments, a ControllerRevision for StatefulSets and
+// DaemonSets.
+type Revision struct {
+	Name     string
+	Number   int64
+	Created  time.Time
+	Template corev1.PodTemplateSpec
+}
+
+// sortRevisions orders revisions newest first.
+func sortRevisions(revs []Revision) {
+	slices.SortFunc(revs, func(a, b Revision) int {
+		if c := cmp.Compare(b.Number, a.Number); c != 0 {
+			return c
+		}
+		return b.Created.Compare(a.Created)
+	})
+}
+
+// controllerRevisionHistory lists the ControllerRevisions owned by obj,
+// newest first. ControllerRevisions carry the pod template labels, so the
+// workload selector finds them.
+func controllerRevisionHistory(
+	ctx context.Context, c client.Client, obj client.Object, selector *metav1.LabelSelector,
+) ([]Revision, error) {
+	list := &appsv1.ControllerRevisionList{}
+	opts := []client.ListOption{client.InNamespace(obj.GetNamespace())}
+	if selector != nil {
+		opts = append(opts, client.MatchingLabels(selector.MatchLabels))
+	}
+	if err := c.List(ctx, list, opts...); err != nil {
+		return nil, fmt.Errorf("list controllerrevisions: %w", err)
+	}
+	var out []Revision
+	for i := range list.Items {
+		cr := &list.Items[i]
+		if !metav1.IsControlledBy(cr, obj) {
+			continue
+		}
+		// StatefulSet and DaemonSet revisions store a patch of the form
+		// {"spec":{"template":{...,"$patch":"replace"}}}.
+		var data struct {
+			Spec struct {
+				Template corev1.PodTemplateSpec `json:"template"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(cr.Data.Raw, &data); err != nil {
+			continue
+		}
+		out = append(out, Revision{
+			Name: cr.Name, Number: cr.Revision, Created: cr.CreationTimestamp.Time, Template: data.Spec.Template,
+		})
+	}
+	sortRevisions(out)
+	return out, nil
+}
+
+// previousTemplate returns the newest template in history that differs from
+// current, or nil. Skipping equal templates makes the result independent of
+// whether the workload controller has created the new revision yet.
+func previousTemplate(history []Revision, current *corev1.PodTemplateSpec) *corev1.PodTemplateSpec {
+	for i := range history {
+		if !equality.Semantic.DeepEqual(history[i].Template, *current) {
+			return &history[i].Template
+		}
+	}
+	return nil
+}
+
+// currentRevision returns the newest revision in history with the current
+// template, or nil when there is none.
+func currentRevision(history []Revision, current *corev1.PodTemplateSpec) *Revision {
+	for i := range history {
+		if equality.Semantic.DeepEqual(history[i].Template, *current) {
+			return &history[i]
+		}
+	}
+	return nil
+}
+
+// revisionCreated returns when the newest revision in history with the
+// current template was created, or the zero time when there is none.
+func revisionCreated(history []Revision, current *corev1.PodTemplateSpec) time.Time {
+	if rev := currentRevision(history, current); rev != nil {
+		return rev.Created
+	}
+	return time.Time{}
+}
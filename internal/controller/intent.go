@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// createOnce creates ev's annotation at most once per rollout step, even if
+// the controller crashes or the state patch fails after Grafana accepted it.
+// It first records the step's idempotency key in PendingAnnotation, then
+// creates the annotation tagged with that key. When a later reconcile finds
+// the key still pending, the annotation is looked up in Grafana by its tag
+// and reused instead of created again; a region is ended again, since the
+// region update may be what failed. Callers clear PendingAnnotation together
+// with the state they store.
+func (l *AnnotationLifecycle) createOnce(ctx context.Context, obj client.Object, ev annotationEvent) (int64, error) {
+	key := idempotencyKey(obj, ev)
+	if obj.GetAnnotations()[PendingAnnotation] == key {
+		ids, err := l.GClient.FindAnnotations(ctx, []string{idempotencyTag(key)})
+		if err != nil {
+			return 0, err
+		}
+		if len(ids) > 0 {
+			log.FromContext(ctx).Info("Reusing annotation created before an interrupted reconcile",
+				"kind", ev.kind, "event", ev.eventType, "annotationID", ids[0])
+			if ev.end.After(ev.at) {
+				ev.idempotencyKey = key
+				tags := l.renderEvent(ctx, ev).Tags
+				if err := l.GClient.UpdateAnnotationToRegion(ctx, ids[0], ev.end, tags); err != nil {
+					return 0, err
+				}
+			}
+			return ids[0], nil
+		}
+	} else if err := l.patchAnnotations(ctx, obj, map[string]string{PendingAnnotation: key}); err != nil {
+		return 0, err
+	}
+	ev.idempotencyKey = key
+	return l.createAnnotation(ctx, ev)
+}
+
+// idempotencyKey identifies one step of one rollout: the workload, the
+// version, the event type, and the start annotation ID stored so far, which
+// differs between rollouts of the same version (e.g. after a rollback).
+// ev.step tells apart events of a type that can repeat within a rollout.
+func idempotencyKey(obj client.Object, ev annotationEvent) string {
+	annotations := obj.GetAnnotations()
+	version := ev.version
+	if version == "" {
+		version = annotations[VersionAnnotation]
+	}
+	parts := []string{
+		string(obj.GetUID()), ev.kind, obj.GetNamespace(), obj.GetName(),
+		version, ev.eventType, annotations[StartAnnotation],
+	}
+	if ev.step != "" {
+		parts = append(parts, ev.step)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "/")))
+	return hex.EncodeToString(sum[:8])
+}
+
+func idempotencyTag(key string) string {
+	return "idempotency-key:" + key
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestReconcile_StatePatchFails_ReusesAnnotation(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	d := deployment("app", "ns", "nginx:1.22", 2)
+	d.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.21"}
+	crashed := false
+	c := fake.NewClientBuilder().
+		WithScheme(testScheme()).
+		WithObjects(trackedNamespace("ns"), d).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				data, _ := patch.Data(obj)
+				if !crashed && strings.Contains(string(data), StartAnnotation) {
+					crashed = true
+					return errors.New("connection reset")
+				}
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+		}).
+		Build()
+	r := &WorkloadReconciler{
+		Client:    c,
+		Scheme:    testScheme(),
+		Adapter:   DeploymentAdapter{},
+		Lifecycle: &AnnotationLifecycle{Client: c, GClient: gc},
+	}
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err == nil {
+		t.Fatal("expected the failed state patch to be returned")
+	}
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+
+	if creates := gc.createCalls(); len(creates) != 1 {
+		t.Fatalf("expected a single start annotation, got %+v", creates)
+	}
+	got := getDeployment(t, c, "app", "ns")
+	if got.Annotations[StartAnnotation] != strconv.FormatInt(gc.createCalls()[0].id, 10) {
+		t.Fatalf("expected the existing annotation to be adopted, got %v", got.Annotations)
+	}
+	if got.Annotations[PendingAnnotation] != "" {
+		t.Fatalf("expected pending key to be cleared, got %q", got.Annotations[PendingAnnotation])
+	}
+}
+
+func TestPatchAnnotations_StaleObjectConflicts(t *testing.T) {
+	d := deployment("app", "ns", "nginx:1.21", 1)
+	r, c := newReconciler([]client.Object{d}, &fakeAnnotationClient{})
+	stale := getDeployment(t, c, "app", "ns")
+	fresh := stale.DeepCopy()
+	ctx := context.Background()
+
+	if err := r.Lifecycle.patchAnnotations(ctx, fresh, map[string]string{StartAnnotation: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	err := r.Lifecycle.patchAnnotations(ctx, stale, map[string]string{StartAnnotation: "2"})
+	if !apierrors.IsConflict(err) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	if got := getDeployment(t, c, "app", "ns"); got.Annotations[StartAnnotation] != "1" {
+		t.Fatalf("expected the first write to survive, got %v", got.Annotations)
+	}
+}
+
+func TestReconcile_MilestonePatchConflicts_ReusesAnnotation(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	d := deployment("app", "ns", "nginx:1.21", 1)
+	d.Spec.Replicas = ptrInt32(2)
+	d.Status = appsv1.DeploymentStatus{
+		Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 3, ObservedGeneration: 1,
+	}
+	d.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.21", StartAnnotation: "100"}
+	conflicts := 0
+	c := fake.NewClientBuilder().
+		WithScheme(testScheme()).
+		WithObjects(trackedNamespace("ns"), d).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				data, _ := patch.Data(obj)
+				// A status update races every milestone state patch once.
+				if conflicts < 2 && strings.Contains(string(data), MilestonesAnnotation) {
+					conflicts++
+					return apierrors.NewConflict(schema.GroupResource{Resource: "deployments"}, obj.GetName(), errors.New("modified"))
+				}
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+		}).
+		Build()
+	r := &WorkloadReconciler{
+		Client:    c,
+		Scheme:    testScheme(),
+		Adapter:   DeploymentAdapter{},
+		Lifecycle: &AnnotationLifecycle{Client: c, GClient: gc, Milestones: true},
+	}
+
+	for range 4 {
+		_, _ = r.Reconcile(context.Background(), reconcileReq("app", "ns"))
+	}
+
+	if creates := gc.createCalls(); len(creates) != 2 {
+		t.Fatalf("expected one annotation per milestone, got %+v", creates)
+	}
+	if v := getDeployment(t, c, "app", "ns").Annotations[MilestonesAnnotation]; v != "first-ready,half-updated" {
+		t.Fatalf("expected milestones to be stored, got %q", v)
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/text/cases"
@@ -14,12 +16,131 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-// AnnotationLifecycle owns the three-phase Grafana annotation sequence
-// (start → end → region) and persists annotation IDs + tracked version
-// as Kubernetes annotations on the workload.
+// AnnotationStyle selects which Grafana annotations a rollout produces.
+type AnnotationStyle string
+
+const (
+	// AnnotationStyleThreePhase creates start and end point annotations and
+	// patches the start annotation into a region. It is the default.
+	AnnotationStyleThreePhase AnnotationStyle = "three-phase"
+	// AnnotationStyleRegion only patches the start annotation into a region;
+	// no end annotation is created and EndAnnotation stores the start ID.
+	AnnotationStyleRegion AnnotationStyle = "region"
+	// AnnotationStylePoints creates start and end point annotations and
+	// never patches them into regions.
+	AnnotationStylePoints AnnotationStyle = "points"
+)
+
+// AnnotationLifecycle owns the Grafana annotation sequence of a rollout
+// (by default start → end → region, see AnnotationStyle) and persists
+// annotation IDs + tracked version as Kubernetes annotations on the workload.
 type AnnotationLifecycle struct {
 	Client  client.Client
 	GClient AnnotationClient
+
+	// APIReader reads around the cache: pods, which are not cached, and
+	// objects re-read after a conflict. Client is used when it is unset.
+	APIReader client.Reader
+
+	// Style selects the annotations created per rollout; empty means three-phase.
+	Style AnnotationStyle
+
+	// Adapters are all watched workload kinds, counted in the annotation
+	// created when tracking is enabled or disabled for a namespace (see
+	// AnnounceTracking).
+	Adapters []WorkloadAdapter
+
+	// TrackDeletion adds DeletionFinalizer to tracked workloads, so their
+	// deletion is annotated as a region lasting until their pods are gone,
+	// even if the controller was down when it started.
+	TrackDeletion bool
+
+	// Bursts, when set, aggregate bursts of rollouts into one summary
+	// annotation (see BurstAggregator).
+	Bursts *BurstAggregator
+
+	// ReleaseRegions adds a region per Helm release spanning the rollouts of
+	// all its components (see openRelease).
+	ReleaseRegions bool
+
+	// RolloutHistory is how many finished rollouts are kept on each workload
+	// in HistoryAnnotation; 0 disables the history.
+	RolloutHistory int
+
+	// Backfill is how many retained revisions are annotated when a workload
+	// is first tracked (see BackfillHistory); 0 disables backfilling.
+	Backfill int
+
+	// Milestones enables point annotations for intermediate rollout
+	// milestones (see RecordProgress).
+	Milestones bool
+
+	// RedactEnvPatterns are glob patterns of env var names whose values are
+	// hidden in change summaries. nil uses DefaultRedactEnvPatterns.
+	RedactEnvPatterns []string
+
+	// TagSchema selects the layout of the standard tags; empty means legacy.
+	TagSchema TagSchema
+
+	// TagLabelKeys and TagAnnotationKeys are workload label and annotation
+	// keys copied into every annotation's tags as key:value.
+	TagLabelKeys      []string
+	TagAnnotationKeys []string
+	// TagNamespaceMetadata also looks those keys up on the workload's
+	// namespace; values on the workload win.
+	TagNamespaceMetadata bool
+
+	// GitOpsLookup reads the revision of the Argo CD Application or Flux
+	// object that manages a workload when recording what triggered a rollout.
+	GitOpsLookup bool
+	// ArgoCDNamespace is where Argo CD Applications live unless the tracking
+	// id names a namespace. Empty means "argocd".
+	ArgoCDNamespace string
+
+	// EnvironmentLabel is the namespace label naming its environment, and
+	// PromotionOrder the environments images are promoted through, e.g.
+	// staging then prod. Rollouts of an image that completed in the previous
+	// environment are annotated with their promotion lead time.
+	EnvironmentLabel string
+	PromotionOrder   []string
+
+	// RolloutStats samples the new pods of open rollouts and adds their
+	// statistics (restarts, time to ready, image pulls, scheduling retries)
+	// to the completion annotation and metrics (see rolloutSample).
+	RolloutStats bool
+
+	// AvailabilityDips annotates dips of availability below what the update
+	// strategy allows during a rollout (see TrackAvailability).
+	AvailabilityDips bool
+
+	// WatchWindow is how long the pods of a completed rollout are watched
+	// for restarts, crash loops and OOM kills (see watchStability); 0
+	// disables the watch. UnstableRestarts is the number of restarts that
+	// marks the rollout unstable; 0 uses DefaultUnstableRestarts.
+	WatchWindow      time.Duration
+	UnstableRestarts int
+
+	// Attributions, when set, hold the users recorded by the attribution
+	// webhook; rollouts they started are attributed to them.
+	Attributions *AttributionStore
+
+	// Templates customise annotation what/text/tags per event type.
+	// nil keeps the defaults.
+	Templates *AnnotationTemplates
+
+	Now func() time.Time // optional; defaults to time.Now
+
+	// Started is when the controller started. A tracked namespace labeled
+	// before it without TrackingAnnotation was tracked by an earlier version
+	// and only gets its state recorded (see AnnounceTracking).
+	Started time.Time
+
+	// finalized holds the workloads whose deletion CompleteDeletion annotated.
+	finalized sync.Map
+	// releases holds the components of open release regions.
+	releases releaseRegions
+	// stats holds the pod samples of open rollouts.
+	stats rolloutStats
 }
 
 // InitializeTracking stores the version without creating a Grafana annotation,
@@ -35,73 +156,266 @@ func (l *AnnotationLifecycle) InitializeTracking(ctx context.Context, obj client
 }
 
 // StartDeployment creates a start annotation and stores the annotation ID + new version.
+// The change categories are tagged on every annotation of the rollout.
 func (l *AnnotationLifecycle) StartDeployment(
+	ctx context.Context, obj client.Object, kind, version, imageRef, imageTag string, change rolloutChange,
+) error {
+	// A rollout cannot start before the previous one did; anything earlier
+	// is a reused revision (rollback) and the time of this change is unknown.
+	startedAt := l.eventTime(l.startTime(obj.GetAnnotations(), maxEventAge), change.startTimes...)
+	if id, ok := l.Bursts.join(burstMember{
+		kind: kind, namespace: obj.GetNamespace(), name: obj.GetName(), imageRef: imageRef, started: startedAt,
+	}, l.now()); ok {
+		return l.joinBurst(ctx, obj, kind, version, id, change, startedAt)
+	}
+	return l.start(ctx, obj, kind, version, imageRef, imageTag, change, startedAt)
+}
+
+// start creates the start annotation of a rollout at startedAt and resets the
+// workload's rollout state. extraTags are added to the start annotation only.
+func (l *AnnotationLifecycle) start(
 	ctx context.Context, obj client.Object, kind, version, imageRef, imageTag string,
+	change rolloutChange, startedAt time.Time, extraTags ...string,
 ) error {
 	logger := log.FromContext(ctx)
-	id, err := l.createAnnotation(ctx, kind, obj.GetName(), obj.GetNamespace(), imageTag, imageRef, "started")
+	changed := strings.Join(change.categories, ",")
+	trigger := l.provenance(ctx, obj)
+	if change.author != nil {
+		trigger.user = change.author.User
+	}
+	tags := trigger.tags()
+	promoted := l.promotedFrom(ctx, obj, l.resolveImage(ctx, obj, kind, imageRef), startedAt)
+	if promoted != nil {
+		tags = append(tags, "promoted-from:"+sanitizeForLog(promoted.from))
+	}
+	triggerTags := strings.Join(tags, ",")
+	id, err := l.createOnce(ctx, obj, annotationEvent{
+		obj: obj, kind: kind, name: obj.GetName(), namespace: obj.GetNamespace(),
+		version: version, imageRef: imageRef, imageTag: imageTag, eventType: "started", at: startedAt,
+		changes: change.categories,
+		detail:  joinNonEmpty(" — ", change.summary, trigger.summary(), promoted.summary()),
+		tags: append(rolloutTags(map[string]string{ChangeAnnotation: changed, TriggerAnnotation: triggerTags}),
+			extraTags...),
+	})
 	if err != nil {
 		logger.Error(err, "Failed to create start annotation")
 		return err
 	}
 	if err := l.patchAnnotations(ctx, obj, map[string]string{
-		StartAnnotation:   strconv.FormatInt(id, 10),
-		EndAnnotation:     "",
-		VersionAnnotation: version,
+		StartAnnotation:      strconv.FormatInt(id, 10),
+		EndAnnotation:        "",
+		VersionAnnotation:    version,
+		MilestonesAnnotation: "",
+		StartTimeAnnotation:  startedAt.UTC().Format(time.RFC3339),
+		TimedOutAnnotation:   "",
+		ChangeAnnotation:     changed,
+		TriggerAnnotation:    triggerTags,
+		PendingAnnotation:    "",
+		BurstAnnotation:      "",
+		WatchAnnotation:      "",
 	}); err != nil {
 		logger.Error(err, "Failed to store start annotation")
 		return err
 	}
-	logger.Info("Created start annotation", "kind", kind, "annotationID", id, "version", version)
+	logger.Info("Created start annotation", "kind", kind, "annotationID", id, "version", version, "startedAt", startedAt,
+		"change", changed, "trigger", trigger.tool, "user", sanitizeForLog(trigger.user))
+	promoted.observe(ctx)
+	l.openRelease(ctx, obj, kind, startedAt)
 	return nil
 }
 
 // CompleteDeployment creates an end annotation and patches the start annotation
-// into a time-region. Idempotent — returns nil if already completed or if
-// there is no start annotation to complete.
+// into a time-region, as far as the annotation style asks for them.
+// Idempotent — returns nil if already completed or if there is no start
+// annotation to complete. A rollout that already timed out only gets a late
+// completion; in the region style its region is extended to the completion.
+// completedAt is when Kubernetes reports the rollout complete; the current
+// time is used when it is unknown or implausible.
 func (l *AnnotationLifecycle) CompleteDeployment(
-	ctx context.Context, obj client.Object, kind, imageRef, imageTag string,
+	ctx context.Context, obj client.Object, kind, imageRef, imageTag string, completedAt time.Time,
+) error {
+	return l.complete(ctx, obj, kind, imageRef, imageTag, completedAt)
+}
+
+// complete implements CompleteDeployment; extraTags are added to the end
+// annotation and the region.
+func (l *AnnotationLifecycle) complete(
+	ctx context.Context, obj client.Object, kind, imageRef, imageTag string, completedAt time.Time,
+	extraTags ...string,
 ) error {
 	annotations := obj.GetAnnotations()
+	if annotations[BurstAnnotation] != "" {
+		return l.completeBurstMember(ctx, obj, kind, imageRef, imageTag, completedAt)
+	}
 	startID := annotations[StartAnnotation]
-	if startID == "" || annotations[EndAnnotation] != "" {
+	timedOut := annotations[TimedOutAnnotation] != ""
+	if startID == "" || (annotations[EndAnnotation] != "" && !timedOut) {
 		return nil
 	}
 
 	logger := log.FromContext(ctx)
-	id, err := l.createAnnotation(ctx, kind, obj.GetName(), obj.GetNamespace(), imageTag, imageRef, "completed")
-	if err != nil {
-		logger.Error(err, "Failed to create end annotation")
-		return err
+	end := l.eventTime(l.startTime(annotations, maxEventAge), completedAt)
+	// The sample is released only once the completion is stored, so a
+	// retry still reports the pods seen during the whole rollout.
+	sampleKey := statsKey(obj, kind)
+	stats := l.stats.get(sampleKey)
+	endTags := extraTags
+	if timedOut {
+		endTags = append(endTags, l.flagTag("outcome", "late"))
 	}
-	if err := l.patchAnnotations(ctx, obj, map[string]string{
-		EndAnnotation: strconv.FormatInt(id, 10),
-	}); err != nil {
+	image := l.resolveImage(ctx, obj, kind, imageRef)
+	var promoted *promotion
+	if !strings.Contains(annotations[TriggerAnnotation], "promoted-from:") {
+		// An image pushed under a tag is only matched once its pods report
+		// the digest they run, so the promotion shows on the completion.
+		promoted = l.promotedFrom(ctx, obj, image, l.startTime(annotations, maxEventAge))
+	}
+	if promoted != nil {
+		endTags = append(endTags, "promoted-from:"+sanitizeForLog(promoted.from))
+	}
+	endID := startID
+	if l.Style == AnnotationStyleRegion {
+		// The region keeps the start text; the statistics go into its tags.
+		if err := l.closeRegion(ctx, obj, kind, imageTag, startID, end,
+			append(endTags, stats.tags()...)...); err != nil {
+			return err
+		}
+	} else {
+		ev := annotationEvent{
+			obj: obj, kind: kind, name: obj.GetName(), namespace: obj.GetNamespace(),
+			imageRef: imageRef, imageTag: imageTag, eventType: "completed", at: end,
+			tags: append(rolloutTags(annotations), endTags...),
+		}
+		if stats != nil {
+			ev.detail = stats.summary()
+		}
+		ev.detail = joinNonEmpty(" — ", ev.detail, promoted.summary())
+		if timedOut {
+			ev.text = fmt.Sprintf("Completed deployment %s after its rollout deadline", imageRef)
+		}
+		id, err := l.createOnce(ctx, obj, ev)
+		if err != nil {
+			logger.Error(err, "Failed to create end annotation")
+			return err
+		}
+		endID = strconv.FormatInt(id, 10)
+	}
+	patch := map[string]string{
+		EndAnnotation:      endID,
+		TimedOutAnnotation: "",
+		PendingAnnotation:  "",
+	}
+	l.startWatch(patch, end)
+	outcome := "completed"
+	if timedOut {
+		outcome = "late"
+	}
+	l.recordRollout(patch, annotations, RolloutRecord{
+		Version: annotations[VersionAnnotation], Image: imageRef, End: end, Outcome: outcome, IDs: annotationIDs(endID),
+	})
+	if err := l.patchAnnotations(ctx, obj, patch); err != nil {
 		logger.Error(err, "Failed to store end annotation")
 		return err
 	}
-	if sid, err := strconv.ParseInt(startID, 10, 64); err == nil {
-		tags := []string{
-			"deploy",
-			sanitizeForLog(obj.GetNamespace()),
-			sanitizeForLog(obj.GetName()),
-			sanitizeForLog(imageTag),
-			"region", kind,
+	if l.threePhase() && !timedOut {
+		_ = l.closeRegion(ctx, obj, kind, imageTag, startID, end, endTags...)
+	}
+	l.closeRelease(ctx, obj, kind, end)
+	l.recordPromotion(ctx, obj, image, end)
+	promoted.observe(ctx)
+	if stats != nil {
+		l.stats.take(sampleKey)
+		stats.observe(kind, obj.GetNamespace())
+	}
+	logger.Info("Workload completed", "kind", kind, "endAnnotationID", endID, "late", timedOut, "completedAt", end)
+	return nil
+}
+
+// TimeoutDeployment closes an open rollout as timed-out once it has run
+// longer than deadline: depending on the annotation style it creates a
+// timed-out end annotation and/or patches the start annotation into a
+// region tagged timed-out. The rollout stays watched, so
+// CompleteDeployment still records a late completion. failures, the reasons
+// the new pods are not ready, are added to the text and tags.
+// Returns how long until the deadline is reached, or 0 when there is
+// nothing left to wait for.
+func (l *AnnotationLifecycle) TimeoutDeployment(
+	ctx context.Context, obj client.Object, kind, imageRef, imageTag string, deadline time.Duration,
+	failures podFailures,
+) (time.Duration, error) {
+	remaining, open := l.untilDeadline(obj, deadline)
+	if !open || remaining > 0 {
+		return remaining, nil
+	}
+	annotations := obj.GetAnnotations()
+	startID := annotations[StartAnnotation]
+	startedAt, _ := time.Parse(time.RFC3339, annotations[StartTimeAnnotation])
+
+	logger := log.FromContext(ctx)
+	outcome := append([]string{l.flagTag("outcome", "timed-out")}, failures.tags()...)
+	end := startedAt.Add(deadline)
+	endID := startID
+	if l.Style == AnnotationStyleRegion {
+		if err := l.closeRegion(ctx, obj, kind, imageTag, startID, end, outcome...); err != nil {
+			return 0, err
 		}
-		rctx, cancel := context.WithTimeout(ctx, 20*time.Second)
-		defer cancel()
-		if err := l.GClient.UpdateAnnotationToRegion(rctx, sid, tags); err != nil {
-			logger.Error(err, "Failed to update start annotation to region", "startAnnotationID", sid)
+	} else {
+		id, err := l.createOnce(ctx, obj, annotationEvent{
+			obj: obj, kind: kind, name: obj.GetName(), namespace: obj.GetNamespace(),
+			imageRef: imageRef, imageTag: imageTag, eventType: "timed-out", at: end,
+			text:   fmt.Sprintf("Deployment %s not ready after %s", imageRef, deadline),
+			detail: failures.summary(),
+			tags:   append(rolloutTags(annotations), failures.tags()...),
+		})
+		if err != nil {
+			logger.Error(err, "Failed to create timed-out annotation")
+			return 0, err
 		}
+		endID = strconv.FormatInt(id, 10)
 	}
-	logger.Info("Workload completed", "kind", kind, "endAnnotationID", id)
-	return nil
+	patch := map[string]string{
+		EndAnnotation:      endID,
+		TimedOutAnnotation: "true",
+		PendingAnnotation:  "",
+	}
+	l.recordRollout(patch, annotations, RolloutRecord{
+		Version: annotations[VersionAnnotation], Image: imageRef, End: end, Outcome: "timed-out", IDs: annotationIDs(endID),
+	})
+	if err := l.patchAnnotations(ctx, obj, patch); err != nil {
+		logger.Error(err, "Failed to store timed-out annotation")
+		return 0, err
+	}
+	if l.threePhase() {
+		_ = l.closeRegion(ctx, obj, kind, imageTag, startID, end, outcome...)
+	}
+	l.closeRelease(ctx, obj, kind, end)
+	logger.Info("Workload rollout timed out", "kind", kind, "deadline", deadline, "endAnnotationID", endID,
+		"reasons", strings.Join(failures.tags(), ","))
+	return 0, nil
+}
+
+// untilDeadline returns how long the open rollout of obj has left before
+// deadline, negative once it passed. open is false when there is no rollout
+// that can time out: no deadline, no open rollout, or one started before
+// start times were recorded.
+func (l *AnnotationLifecycle) untilDeadline(obj client.Object, deadline time.Duration) (time.Duration, bool) {
+	annotations := obj.GetAnnotations()
+	if deadline <= 0 || annotations[StartAnnotation] == "" || annotations[EndAnnotation] != "" {
+		return 0, false
+	}
+	startedAt, err := time.Parse(time.RFC3339, annotations[StartTimeAnnotation])
+	if err != nil {
+		return 0, false
+	}
+	return deadline - l.now().Sub(startedAt), true
 }
 
 // RecordDeletion creates a deletion annotation. No workload object is needed
 // because the workload has already been deleted.
 func (l *AnnotationLifecycle) RecordDeletion(ctx context.Context, kind, name, namespace string) error {
-	if _, err := l.createAnnotation(ctx, kind, name, namespace, "", "", "deleted"); err != nil {
+	if _, err := l.createAnnotation(ctx, annotationEvent{
+		kind: kind, name: name, namespace: namespace, eventType: "deleted",
+	}); err != nil {
 		log.FromContext(ctx).Error(err, "Failed to create deletion annotation")
 		return err
 	}
@@ -109,14 +423,18 @@ func (l *AnnotationLifecycle) RecordDeletion(ctx context.Context, kind, name, na
 	return nil
 }
 
-// CleanupAnnotations removes all deployment-annotator annotations from a workload.
+// CleanupAnnotations removes all deployment-annotator annotations and the
+// deletion finalizer from a workload.
 func (l *AnnotationLifecycle) CleanupAnnotations(ctx context.Context, obj client.Object) error {
+	if err := setFinalizer(ctx, l.Client, obj, false); err != nil {
+		return err
+	}
 	annotations := obj.GetAnnotations()
 	if annotations == nil {
 		return nil
 	}
 	has := false
-	for _, k := range []string{StartAnnotation, EndAnnotation, VersionAnnotation} {
+	for _, k := range trackingAnnotations {
 		if _, ok := annotations[k]; ok {
 			has = true
 			break
@@ -125,38 +443,225 @@ func (l *AnnotationLifecycle) CleanupAnnotations(ctx context.Context, obj client
 	if !has {
 		return nil
 	}
-	return l.patchAnnotations(ctx, obj, map[string]string{
-		StartAnnotation: "", EndAnnotation: "", VersionAnnotation: "",
-	})
+	cleared := make(map[string]string, len(trackingAnnotations))
+	for _, k := range trackingAnnotations {
+		cleared[k] = ""
+	}
+	return l.patchAnnotations(ctx, obj, cleared)
 }
 
 // --- internal helpers (absorbed from helpers.go) ---
 
-func (l *AnnotationLifecycle) createAnnotation(
-	ctx context.Context, kind, name, namespace, imageTag, imageRef, eventType string,
-) (int64, error) {
-	sName := sanitizeForLog(name)
-	sNS := sanitizeForLog(namespace)
-	sTag := sanitizeForLog(imageTag)
-	sRef := sanitizeForLog(imageRef)
-	action := map[string]string{"started": "start", "completed": "end", "deleted": "delete"}[eventType]
+// annotationEvent describes one Grafana point annotation for a workload.
+type annotationEvent struct {
+	obj                   client.Object // nil for deletions
+	kind, name, namespace string
+	version               string // defaults to the tracked version of obj
+	imageRef, imageTag    string
+	eventType             string
+	at                    time.Time // when the event happened; defaults to now
+	end                   time.Time // when after at, the annotation is created as a region ending here
+	idempotencyKey        string    // tagged after templates are applied, see createOnce
+	lookupTag             string    // tagged after templates are applied, found with FindAnnotations
+	step                  string    // tells apart repeated events of a type in a rollout, see idempotencyKey
+	changes               []string  // defaults to the change categories stored on obj
+	text                  string    // replaces the default "<Event> deployment <image>" text
+	detail                string    // appended to the text
+	tags                  []string  // appended after the standard tags
+}
+
+func (l *AnnotationLifecycle) createAnnotation(ctx context.Context, ev annotationEvent) (int64, error) {
+	if ev.at.IsZero() {
+		ev.at = l.now()
+	}
+	out := l.renderEvent(ctx, ev)
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	id, err := l.GClient.CreateAnnotation(ctx, out.What, out.Tags, out.Text, ev.at)
+	if err != nil || !ev.end.After(ev.at) {
+		return id, err
+	}
+	return id, l.GClient.UpdateAnnotationToRegion(ctx, id, ev.end, out.Tags)
+}
+
+// renderEvent returns the what, text and tags ev's annotation is created
+// with, after templates.
+func (l *AnnotationLifecycle) renderEvent(ctx context.Context, ev annotationEvent) AnnotationText {
+	sName := sanitizeForLog(ev.name)
+	sRef := sanitizeForLog(ev.imageRef)
+	action := map[string]string{
+		"started": "start", "completed": "end", "deleted": "delete",
+		"milestone": "milestone", "timed-out": "timeout", "backfill": "backfill",
+		"tracking-enabled": "tracking-enabled", "tracking-disabled": "tracking-disabled",
+		"deleting": "deleting", "namespace-deleted": "namespace-deleted", "burst": "burst",
+		"release": "release", "unstable": "unstable",
+		"availability-dip": "availability-dip",
+	}[ev.eventType]
 	what := fmt.Sprintf("deploy-%s:%s", action, sName)
 	if action == "" {
 		what = fmt.Sprintf("deploy:%s", sName)
 	}
-	data := fmt.Sprintf("%s deployment %s", cases.Title(language.English).String(eventType), sRef)
-	tags := []string{"deploy", sNS, sName, sTag, eventType, kind}
+	data := fmt.Sprintf("%s deployment %s", cases.Title(language.English).String(ev.eventType), sRef)
+	if ev.text != "" {
+		data = sanitizeForLog(ev.text)
+	}
+	if ev.detail != "" {
+		data += " — " + sanitizeForLog(ev.detail)
+	}
+	tags := l.baseTags(ev.kind, ev.namespace, ev.name, ev.imageTag, ev.eventType)
+	tags = append(tags, ev.tags...)
+	tags = append(tags, l.metadataTags(ctx, ev.obj, ev.namespace)...)
+
+	out := l.Templates.render(ctx, l.templateData(ev, AnnotationText{What: what, Text: data, Tags: tags}))
+	if ev.idempotencyKey != "" {
+		out.Tags = append(out.Tags, idempotencyTag(ev.idempotencyKey))
+	}
+	if ev.lookupTag != "" {
+		out.Tags = append(out.Tags, ev.lookupTag)
+	}
+	return out
+}
+
+// closeRegion patches the start annotation into a time-region ending at end.
+// Failures are logged and returned; in the three-phase style callers ignore
+// them because the end annotation already marks the outcome.
+func (l *AnnotationLifecycle) closeRegion(
+	ctx context.Context, obj client.Object, kind, imageTag, startID string, end time.Time, extraTags ...string,
+) error {
+	sid, err := strconv.ParseInt(startID, 10, 64)
+	if err != nil {
+		return nil
+	}
+	tags := l.baseTags(kind, obj.GetNamespace(), obj.GetName(), imageTag, "region")
+	tags = append(tags, extraTags...)
+	tags = append(tags, rolloutTags(obj.GetAnnotations())...)
+	tags = append(tags, l.metadataTags(ctx, obj, obj.GetNamespace())...)
+	out := l.Templates.render(ctx, l.templateData(annotationEvent{
+		obj: obj, kind: kind, name: obj.GetName(), namespace: obj.GetNamespace(),
+		imageTag: imageTag, eventType: "region", at: end,
+	}, AnnotationText{Tags: tags}))
 	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
-	return l.GClient.CreateAnnotation(ctx, what, tags, data)
+	if err := l.GClient.UpdateAnnotationToRegion(ctx, sid, end, out.Tags); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update start annotation to region", "startAnnotationID", sid)
+		return err
+	}
+	return nil
+}
+
+// templateData collects what annotation templates can reference about ev.
+func (l *AnnotationLifecycle) templateData(ev annotationEvent, def AnnotationText) TemplateData {
+	td := TemplateData{
+		Event: ev.eventType, Kind: ev.kind, Name: ev.name, Namespace: ev.namespace,
+		Version: ev.version, ImageRef: ev.imageRef, ImageTag: ev.imageTag,
+		Changes: ev.changes, Summary: ev.detail,
+		Time: ev.at, Default: def,
+	}
+	if td.Time.IsZero() {
+		td.Time = l.now()
+	}
+	if ev.eventType == "started" {
+		td.StartTime = td.Time
+	}
+	if ev.obj == nil {
+		return td
+	}
+	annotations := ev.obj.GetAnnotations()
+	td.Object = ev.obj
+	td.Labels = ev.obj.GetLabels()
+	td.Annotations = annotations
+	if td.Version == "" {
+		td.Version = annotations[VersionAnnotation]
+	}
+	if td.Changes == nil && annotations[ChangeAnnotation] != "" {
+		td.Changes = strings.Split(annotations[ChangeAnnotation], ",")
+	}
+	if td.StartTime.IsZero() {
+		if t, err := time.Parse(time.RFC3339, annotations[StartTimeAnnotation]); err == nil {
+			td.StartTime = t
+			td.Duration = td.Time.Sub(t).Round(time.Second)
+		}
+	}
+	return td
+}
+
+// redactEnv reports whether the value of the named env var must be hidden.
+func (l *AnnotationLifecycle) redactEnv(name string) bool {
+	patterns := l.RedactEnvPatterns
+	if patterns == nil {
+		patterns = DefaultRedactEnvPatterns
+	}
+	upper := strings.ToUpper(name)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToUpper(p), upper); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// maxEventAge bounds how far back a Kubernetes event time is trusted when
+// nothing else limits it, e.g. the first rollout after tracking started.
+const maxEventAge = time.Hour
+
+// eventTime returns the first candidate that is a plausible time for an
+// event observed now, or now when there is none.
+func (l *AnnotationLifecycle) eventTime(notBefore time.Time, candidates ...time.Time) time.Time {
+	t, _ := l.plausibleTime(notBefore, candidates...)
+	return t
+}
+
+// plausibleTime returns the first candidate that is known, not in the future
+// and not before notBefore. Otherwise it returns now and false.
+func (l *AnnotationLifecycle) plausibleTime(notBefore time.Time, candidates ...time.Time) (time.Time, bool) {
+	now := l.now()
+	for _, t := range candidates {
+		if !t.IsZero() && !t.After(now) && !t.Before(notBefore) {
+			return t, true
+		}
+	}
+	return now, false
+}
+
+// startTime returns the recorded start of the current rollout, or now minus
+// maxAge when it is unknown.
+func (l *AnnotationLifecycle) startTime(annotations map[string]string, maxAge time.Duration) time.Time {
+	if t, err := time.Parse(time.RFC3339, annotations[StartTimeAnnotation]); err == nil {
+		return t
+	}
+	return l.now().Add(-maxAge)
 }
 
+// threePhase reports whether rollouts get both end annotations and regions.
+func (l *AnnotationLifecycle) threePhase() bool {
+	return l.Style == "" || l.Style == AnnotationStyleThreePhase
+}
+
+func (l *AnnotationLifecycle) reader() client.Reader {
+	if l.APIReader != nil {
+		return l.APIReader
+	}
+	return l.Client
+}
+
+func (l *AnnotationLifecycle) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+	return time.Now()
+}
+
+// patchAnnotations merges annotations into obj. The patch carries obj's
+// resourceVersion, so it fails with a conflict instead of overwriting state
+// written since obj was read; the reconcile is then retried with a fresh object.
 func (l *AnnotationLifecycle) patchAnnotations(
 	ctx context.Context, obj client.Object, annotations map[string]string,
 ) error {
-	patch := map[string]interface{}{
-		"metadata": map[string]interface{}{"annotations": annotations},
+	metadata := map[string]interface{}{"annotations": annotations}
+	if rv := obj.GetResourceVersion(); rv != "" {
+		metadata["resourceVersion"] = rv
 	}
+	patch := map[string]interface{}{"metadata": metadata}
 	b, err := json.Marshal(patch)
 	if err != nil {
 		return fmt.Errorf("marshal patch: %w", err)
@@ -167,6 +672,17 @@ func (l *AnnotationLifecycle) patchAnnotations(
 	return nil
 }
 
+// joinNonEmpty joins the non-empty parts with sep.
+func joinNonEmpty(sep string, parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, sep)
+}
+
 // extractImageTag returns a human-friendly version tag from an image reference.
 func extractImageTag(imageRef string) string {
 	if at := strings.LastIndex(imageRef, "@"); at != -1 {
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var promotionLeadTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name: "deployment_annotator_promotion_lead_time_seconds",
+	Help: "Time from an image first completing a rollout in one environment to its rollout in the next.",
+	// 5m to about a week
+	Buckets: prometheus.ExponentialBuckets(300, 2, 12),
+}, []string{"from", "to"})
+
+// Rollout statistics, observed when a rollout completes (see rolloutSample).
+var (
+	podReadySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "deployment_annotator_pod_ready_seconds",
+		Help:    "Time from creation to ready of the new pods of completed rollouts.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"kind", "namespace"})
+	imagePullSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "deployment_annotator_image_pull_seconds",
+		Help:    "Image pull durations of the new pods of completed rollouts, from pod events.",
+		Buckets: prometheus.ExponentialBuckets(0.25, 2, 12),
+	}, []string{"kind", "namespace"})
+	rolloutPodRestarts = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "deployment_annotator_rollout_pod_restarts",
+		Help:    "Container restarts of the new pods per completed rollout.",
+		Buckets: []float64{0, 1, 2, 5, 10, 20, 50},
+	}, []string{"kind", "namespace"})
+	rolloutSchedulingRetries = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "deployment_annotator_rollout_scheduling_retries",
+		Help:    "Failed scheduling attempts of the new pods per completed rollout.",
+		Buckets: []float64{0, 1, 2, 5, 10, 20, 50},
+	}, []string{"kind", "namespace"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(promotionLeadTime,
+		podReadySeconds, imagePullSeconds, rolloutPodRestarts, rolloutSchedulingRetries)
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// rolloutMilestone is an intermediate point of a rollout worth marking on a graph.
+type rolloutMilestone struct {
+	name    string
+	text    string
+	reached func(p RolloutProgress) bool
+}
+
+// milestones are checked in order; a single reconcile may record several.
+var milestones = []rolloutMilestone{
+	{
+		name: "first-ready",
+		text: "First new replica ready",
+		// More available replicas than old ones means at least one new replica is available.
+		reached: func(p RolloutProgress) bool { return p.Updated > 0 && p.Available > p.Old },
+	},
+	{
+		name:    "half-updated",
+		text:    "Half of replicas updated",
+		reached: func(p RolloutProgress) bool { return p.Updated*2 >= p.Desired },
+	},
+	{
+		name:    "old-drained",
+		text:    "Old replicas scaled to zero",
+		reached: func(p RolloutProgress) bool { return p.Updated > 0 && p.Old == 0 },
+	},
+}
+
+// reachedMilestones returns the names of milestones the progress snapshot has reached.
+// A snapshot that predates the current generation, or a workload scaled to
+// zero, reaches none.
+func reachedMilestones(p RolloutProgress) []string {
+	if !p.Observed || p.Desired <= 0 {
+		return nil
+	}
+	var out []string
+	for _, m := range milestones {
+		if m.reached(p) {
+			out = append(out, m.name)
+		}
+	}
+	return out
+}
+
+// RecordProgress creates one milestone annotation per newly reached milestone
+// of an open rollout. No-op unless Milestones is enabled; each milestone is
+// annotated at most once per version.
+func (l *AnnotationLifecycle) RecordProgress(
+	ctx context.Context, obj client.Object, kind, imageRef, imageTag string, p RolloutProgress,
+) error {
+	if !l.Milestones {
+		return nil
+	}
+	annotations := obj.GetAnnotations()
+	if annotations[StartAnnotation] == "" || annotations[EndAnnotation] != "" {
+		return nil
+	}
+
+	var done []string
+	if v := annotations[MilestonesAnnotation]; v != "" {
+		done = strings.Split(v, ",")
+	}
+	logger := log.FromContext(ctx)
+	reached := reachedMilestones(p)
+	for _, m := range milestones {
+		if slices.Contains(done, m.name) || !slices.Contains(reached, m.name) {
+			continue
+		}
+		if _, err := l.createOnce(ctx, obj, annotationEvent{
+			obj: obj, kind: kind, name: obj.GetName(), namespace: obj.GetNamespace(),
+			imageRef: imageRef, imageTag: imageTag, eventType: "milestone", step: m.name,
+			text: fmt.Sprintf("%s for %s %s (%d/%d updated)", m.text, kind, imageRef, p.Updated, p.Desired),
+			tags: append([]string{l.flagTag("milestone", m.name)}, rolloutTags(annotations)...),
+		}); err != nil {
+			logger.Error(err, "Failed to create milestone annotation", "milestone", m.name)
+			return err
+		}
+		// Store each milestone as it is created: a retry after a failed
+		// patch then adopts the pending annotation instead of duplicating it.
+		done = append(done, m.name)
+		if err := l.patchAnnotations(ctx, obj, map[string]string{
+			MilestonesAnnotation: strings.Join(done, ","),
+			PendingAnnotation:    "",
+		}); err != nil {
+			logger.Error(err, "Failed to store milestones")
+			return err
+		}
+		logger.Info("Created milestone annotation", "kind", kind, "milestone", m.name)
+	}
+	return nil
+}
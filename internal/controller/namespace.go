@@ -0,0 +1,286 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Namespace tracking states recorded in TrackingAnnotation.
+const (
+	trackingEnabled = "enabled"
+	trackingDeleted = "deleted"
+)
+
+// NamespaceReconciler announces tracking changes of namespaces (see
+// AnnounceTracking), so that the Grafana and API requests involved stay out
+// of the workload reconcilers' event handlers. Workloads being created or
+// deleted also reconcile their namespace, to keep WorkloadsAnnotation current.
+type NamespaceReconciler struct {
+	client.Client
+	Lifecycle *AnnotationLifecycle
+}
+
+func (r *NamespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if err := r.Lifecycle.AnnounceTracking(ctx, req.Name); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *NamespaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named("namespace").
+		For(&corev1.Namespace{}, builder.WithPredicates(namespaceLabelChangedPredicate()))
+	for _, a := range r.Lifecycle.Adapters {
+		b = b.Watches(a.NewObject(), handler.EnqueueRequestsFromMapFunc(mapWorkloadToNamespace),
+			builder.WithPredicates(predicate.Funcs{
+				UpdateFunc:  func(event.UpdateEvent) bool { return false },
+				GenericFunc: func(event.GenericEvent) bool { return false },
+			}))
+	}
+	return b.Complete(r)
+}
+
+func mapWorkloadToNamespace(_ context.Context, obj client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Name: obj.GetNamespace()}}}
+}
+
+var _ reconcile.Reconciler = (*NamespaceReconciler)(nil)
+
+// AnnounceTracking creates a namespace-level annotation when tracking is
+// enabled or disabled for namespace, or when a tracked namespace is deleted,
+// with the number of workloads affected by kind. The annotation is created
+// before TrackingAnnotation records the new state, through createOnce, so a
+// failure at either step is retried without losing or duplicating it.
+func (l *AnnotationLifecycle) AnnounceTracking(ctx context.Context, namespace string) error {
+	logger := log.FromContext(ctx)
+	var ns corev1.Namespace
+	if err := l.Client.Get(ctx, client.ObjectKey{Name: namespace}, &ns); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		logger.Error(err, "Failed to get namespace for tracking annotation", "namespace", sanitizeForLog(namespace))
+		return err
+	}
+	current := ns.Annotations[TrackingAnnotation]
+	state := trackingState(&ns)
+	if state == current && (state != trackingEnabled || ns.DeletionTimestamp != nil) {
+		return nil
+	}
+	counts, err := l.countWorkloads(ctx, namespace, l.Adapters)
+	if err != nil {
+		logger.Error(err, "Failed to count workloads for tracking annotation", "namespace", sanitizeForLog(namespace))
+		return err
+	}
+	if state == current {
+		return l.recordWorkloads(ctx, &ns, counts)
+	}
+	if recorded, ok := parseWorkloadCounts(ns.Annotations[WorkloadsAnnotation]); ok && state == trackingDeleted {
+		// The namespace controller is already deleting the workloads; count
+		// them as they were while the namespace was active.
+		counts = recorded
+	}
+	if !l.trackedBeforeUpgrade(&ns, current, state) {
+		if err := l.createTrackingAnnotation(ctx, &ns, current, state, counts); err != nil {
+			return err
+		}
+	}
+	patch := map[string]string{TrackingAnnotation: state, PendingAnnotation: ""}
+	switch state {
+	case trackingEnabled:
+		patch[WorkloadsAnnotation] = workloadCountsValue(counts)
+	case "":
+		patch[WorkloadsAnnotation] = ""
+	}
+	if err := l.patchAnnotations(ctx, &ns, patch); err != nil {
+		logger.Error(err, "Failed to record namespace tracking state", "namespace", sanitizeForLog(namespace))
+		return err
+	}
+	return nil
+}
+
+// trackedBeforeUpgrade reports whether ns was already tracked by a version
+// without TrackingAnnotation: it has no recorded state, no announcement in
+// flight, and its label predates the controller.
+func (l *AnnotationLifecycle) trackedBeforeUpgrade(ns *corev1.Namespace, current, state string) bool {
+	if state != trackingEnabled || current != "" || ns.Annotations[PendingAnnotation] != "" || l.Started.IsZero() {
+		return false
+	}
+	return labeledAt(ns).Before(l.Started)
+}
+
+// labeledAt returns when the tracking label of ns was last written, by the
+// managedFields entries owning it, or the creation time of ns when
+// managedFields are not available.
+func labeledAt(ns *corev1.Namespace) time.Time {
+	var latest time.Time
+	for _, mf := range ns.GetManagedFields() {
+		if mf.FieldsV1 == nil || mf.Time == nil {
+			continue
+		}
+		var fields struct {
+			Metadata struct {
+				Labels map[string]json.RawMessage `json:"f:labels"`
+			} `json:"f:metadata"`
+		}
+		if err := json.Unmarshal(mf.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		if _, ok := fields.Metadata.Labels["f:deployment-annotator"]; ok && mf.Time.After(latest) {
+			latest = mf.Time.Time
+		}
+	}
+	if latest.IsZero() {
+		return ns.CreationTimestamp.Time
+	}
+	return latest
+}
+
+// recordWorkloads stores the workload counts of an active tracked namespace
+// in WorkloadsAnnotation when they changed.
+func (l *AnnotationLifecycle) recordWorkloads(ctx context.Context, ns *corev1.Namespace, counts []kindCount) error {
+	v := workloadCountsValue(counts)
+	if ns.Annotations[WorkloadsAnnotation] == v {
+		return nil
+	}
+	if err := l.patchAnnotations(ctx, ns, map[string]string{WorkloadsAnnotation: v}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to record namespace workloads", "namespace", sanitizeForLog(ns.Name))
+		return err
+	}
+	return nil
+}
+
+// workloadCountsValue renders counts for WorkloadsAnnotation.
+func workloadCountsValue(counts []kindCount) string {
+	parts := make([]string, 0, len(counts))
+	for _, c := range counts {
+		parts = append(parts, c.kind+"="+strconv.Itoa(c.count))
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseWorkloadCounts decodes WorkloadsAnnotation; ok is false when it is
+// missing or invalid.
+func parseWorkloadCounts(value string) ([]kindCount, bool) {
+	if value == "" {
+		return nil, false
+	}
+	var counts []kindCount
+	for _, part := range strings.Split(value, ",") {
+		kind, n, _ := strings.Cut(part, "=")
+		count, err := strconv.Atoi(n)
+		if kind == "" || err != nil || count < 0 {
+			return nil, false
+		}
+		counts = append(counts, kindCount{kind, count})
+	}
+	return counts, true
+}
+
+// trackingState is the TrackingAnnotation value ns should carry: deleted once
+// a tracked namespace is terminating, enabled while it is labeled, else empty.
+func trackingState(ns *corev1.Namespace) string {
+	enabled := ns.Labels["deployment-annotator"] == "enabled"
+	current := ns.Annotations[TrackingAnnotation]
+	switch {
+	case ns.DeletionTimestamp != nil:
+		if enabled || current == trackingEnabled {
+			return trackingDeleted
+		}
+		return current
+	case enabled:
+		return trackingEnabled
+	default:
+		return ""
+	}
+}
+
+// namespaceTerminating reports whether a tracked namespace is being deleted,
+// in which case its workloads are summarised by one annotation instead of
+// being annotated one by one.
+func namespaceTerminating(ns *corev1.Namespace) bool {
+	return ns.DeletionTimestamp != nil && trackingState(ns) == trackingDeleted
+}
+
+type kindCount struct {
+	kind  string
+	count int
+}
+
+// countWorkloads returns the workloads of each kind in namespace.
+func (l *AnnotationLifecycle) countWorkloads(
+	ctx context.Context, namespace string, adapters []WorkloadAdapter,
+) ([]kindCount, error) {
+	var counts []kindCount
+	for _, a := range adapters {
+		list := a.NewObjectList()
+		if err := l.Client.List(ctx, list, client.InNamespace(namespace)); err != nil {
+			return nil, err
+		}
+		counts = append(counts, kindCount{a.Kind(), len(a.ExtractItems(list))})
+	}
+	return counts, nil
+}
+
+// createTrackingAnnotation annotates the change of ns from tracking state
+// from to state.
+func (l *AnnotationLifecycle) createTrackingAnnotation(
+	ctx context.Context, ns *corev1.Namespace, from, state string, counts []kindCount,
+) error {
+	namespace := ns.Name
+	total := 0
+	var parts []string
+	for _, c := range counts {
+		total += c.count
+		if c.count > 0 {
+			parts = append(parts, plural(c.count, c.kind))
+		}
+	}
+	var eventType, text string
+	switch state {
+	case trackingEnabled:
+		eventType = "tracking-enabled"
+		text = fmt.Sprintf("Tracking enabled for namespace %s: %s enrolled", namespace, plural(total, "workload"))
+	case trackingDeleted:
+		eventType = "namespace-deleted"
+		text = fmt.Sprintf("Namespace %s deleted: %s removed", namespace, plural(total, "workload"))
+	default:
+		eventType = "tracking-disabled"
+		text = fmt.Sprintf("Tracking disabled for namespace %s: %s cleaned up", namespace, plural(total, "workload"))
+	}
+	if len(parts) > 0 {
+		text += " (" + strings.Join(parts, ", ") + ")"
+	}
+	if _, err := l.createOnce(ctx, ns, annotationEvent{
+		kind: "namespace", name: namespace, namespace: namespace, eventType: eventType, text: text,
+		step: from + ">" + state,
+	}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to create tracking annotation", "namespace", sanitizeForLog(namespace))
+		return err
+	}
+	log.FromContext(ctx).Info("Created tracking annotation", "namespace", sanitizeForLog(namespace),
+		"event", eventType, "workloads", total)
+	return nil
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,268 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func getNamespace(t *testing.T, c client.Client, name string) *corev1.Namespace {
+	t.Helper()
+	ns := &corev1.Namespace{}
+	if err := c.Get(context.Background(), client.ObjectKey{Name: name}, ns); err != nil {
+		t.Fatalf("get namespace: %v", err)
+	}
+	return ns
+}
+
+func reconcileNamespace(t *testing.T, r *WorkloadReconciler, name string) {
+	t.Helper()
+	nr := &NamespaceReconciler{Client: r.Client, Lifecycle: r.Lifecycle}
+	if _, err := nr.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKey{Name: name}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNamespaceReconciler_AnnouncesTrackingOnce(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	sts := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "ns"}}
+	r, c := newReconciler([]client.Object{
+		trackedNamespace("ns"),
+		deployment("api", "ns", "nginx:1.21", 1),
+		deployment("web", "ns", "nginx:1.21", 1),
+		sts,
+	}, gc)
+	r.Lifecycle.Adapters = []WorkloadAdapter{DeploymentAdapter{}, StatefulSetAdapter{}}
+	ctx := context.Background()
+
+	for range 2 {
+		reconcileNamespace(t, r, "ns")
+	}
+	creates := gc.createCalls()
+	if len(creates) != 1 || !slices.Contains(creates[0].tags, "tracking-enabled") {
+		t.Fatalf("expected one tracking-enabled annotation, got %+v", creates)
+	}
+	if want := "Tracking enabled for namespace ns: 3 workloads enrolled (2 deployments, 1 statefulset)"; creates[0].data != want {
+		t.Fatalf("got text %q, want %q", creates[0].data, want)
+	}
+
+	ns := getNamespace(t, c, "ns")
+	delete(ns.Labels, "deployment-annotator")
+	if err := c.Update(ctx, ns); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		reconcileNamespace(t, r, "ns")
+	}
+	creates = gc.createCalls()
+	if len(creates) != 2 || !slices.Contains(creates[1].tags, "tracking-disabled") ||
+		!strings.Contains(creates[1].data, "3 workloads cleaned up") {
+		t.Fatalf("expected one tracking-disabled annotation, got %+v", creates)
+	}
+	if got := getNamespace(t, c, "ns").Annotations[TrackingAnnotation]; got != "" {
+		t.Fatalf("expected tracking state to be cleared, got %q", got)
+	}
+}
+
+func TestNamespaceReconciler_NamespacesLabeledBeforeUpgradeAreNotAnnounced(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	labeled := time.Date(2025, 6, 15, 9, 0, 0, 0, time.UTC)
+	d := deployment("api", "ns", "nginx:1.21", 1)
+	d.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.21"}
+	ns, empty := trackedNamespace("ns"), trackedNamespace("empty")
+	ns.CreationTimestamp = metav1.NewTime(labeled)
+	empty.CreationTimestamp = metav1.NewTime(labeled)
+	r, c := newReconciler([]client.Object{ns, empty, d}, gc)
+	r.Lifecycle.Adapters = []WorkloadAdapter{DeploymentAdapter{}}
+	r.Lifecycle.Started = labeled.Add(time.Hour)
+
+	if reqs := r.mapNamespaceToWorkloads(context.Background(), getNamespace(t, c, "ns")); len(reqs) != 1 {
+		t.Fatalf("expected the workload to be enqueued, got %v", reqs)
+	}
+	for _, name := range []string{"ns", "empty"} {
+		reconcileNamespace(t, r, name)
+		if got := getNamespace(t, c, name).Annotations[TrackingAnnotation]; got != "enabled" {
+			t.Fatalf("expected tracking state of %s to be recorded, got %q", name, got)
+		}
+	}
+	if creates := gc.createCalls(); len(creates) != 0 {
+		t.Fatalf("expected no tracking annotation, got %+v", creates)
+	}
+}
+
+func TestNamespaceReconciler_WorkloadTrackedBeforeRetryIsStillAnnounced(t *testing.T) {
+	gc := &fakeAnnotationClient{createErr: errors.New("grafana unavailable")}
+	started := time.Date(2025, 6, 15, 9, 0, 0, 0, time.UTC)
+	// The namespace is labeled while the controller runs.
+	ns := trackedNamespace("ns")
+	ns.CreationTimestamp = metav1.NewTime(started.Add(time.Minute))
+	r, c := newReconciler([]client.Object{ns, deployment("api", "ns", "nginx:1.21", 1)}, gc)
+	r.Lifecycle.Adapters = []WorkloadAdapter{DeploymentAdapter{}}
+	r.Lifecycle.Started = started
+	nr := &NamespaceReconciler{Client: c, Lifecycle: r.Lifecycle}
+	req := ctrl.Request{NamespacedName: client.ObjectKey{Name: "ns"}}
+	ctx := context.Background()
+
+	if _, err := nr.Reconcile(ctx, req); err == nil {
+		t.Fatal("expected the Grafana failure to be returned for a retry")
+	}
+	// The label event also enqueued the workload, which starts being tracked
+	// before the namespace is retried.
+	gc.createErr = nil
+	if _, err := r.Reconcile(ctx, reconcileReq("api", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	if getDeployment(t, c, "api", "ns").Annotations[VersionAnnotation] == "" {
+		t.Fatal("expected the workload to be tracked")
+	}
+	if _, err := nr.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(gc.createCalls(), func(call annotationCall) bool {
+		return slices.Contains(call.tags, "tracking-enabled")
+	}) {
+		t.Fatalf("expected the tracking annotation on retry, got %+v", gc.createCalls())
+	}
+}
+
+func TestNamespaceDeletion_SummarisedOnce(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	ns := trackedNamespace("ns")
+	ns.Finalizers = []string{"kubernetes"}
+	ns.Annotations = map[string]string{TrackingAnnotation: "enabled"}
+	held := readyDeployment("held", "ns", "nginx:1.21", 1)
+	held.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.21"}
+	held.Finalizers = []string{DeletionFinalizer}
+	r, c := newReconciler([]client.Object{ns, deployment("api", "ns", "nginx:1.21", 1), held}, gc)
+	r.Lifecycle.TrackDeletion = true
+	r.Lifecycle.Adapters = []WorkloadAdapter{DeploymentAdapter{}}
+	ctx := context.Background()
+
+	if err := c.Delete(ctx, getNamespace(t, c, "ns")); err != nil {
+		t.Fatal(err)
+	}
+	if reqs := r.mapNamespaceToWorkloads(ctx, getNamespace(t, c, "ns")); len(reqs) != 0 {
+		t.Fatalf("expected nothing to be enqueued for a terminating namespace, got %v", reqs)
+	}
+	reconcileNamespace(t, r, "ns")
+	for _, name := range []string{"api", "held"} {
+		if err := c.Delete(ctx, getDeployment(t, c, name, "ns")); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := r.Reconcile(ctx, reconcileReq(name, "ns")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	creates := gc.createCalls()
+	if len(creates) != 1 || !slices.Contains(creates[0].tags, "namespace-deleted") {
+		t.Fatalf("expected a single namespace deletion annotation, got %+v", creates)
+	}
+	if want := "Namespace ns deleted: 2 workloads removed (2 deployments)"; creates[0].data != want {
+		t.Fatalf("got text %q, want %q", creates[0].data, want)
+	}
+	if got := getNamespace(t, c, "ns").Annotations[TrackingAnnotation]; got != "deleted" {
+		t.Fatalf("expected namespace deletion to be recorded, got %q", got)
+	}
+}
+
+func TestNamespaceReconciler_GrafanaFailureKeepsStatePending(t *testing.T) {
+	gc := &fakeAnnotationClient{createErr: errors.New("grafana unavailable")}
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), deployment("api", "ns", "nginx:1.21", 1)}, gc)
+	r.Lifecycle.Adapters = []WorkloadAdapter{DeploymentAdapter{}}
+	nr := &NamespaceReconciler{Client: c, Lifecycle: r.Lifecycle}
+	req := ctrl.Request{NamespacedName: client.ObjectKey{Name: "ns"}}
+
+	if _, err := nr.Reconcile(context.Background(), req); err == nil {
+		t.Fatal("expected the Grafana failure to be returned for a retry")
+	}
+	if got := getNamespace(t, c, "ns").Annotations[TrackingAnnotation]; got != "" {
+		t.Fatalf("expected the tracking state not to be recorded yet, got %q", got)
+	}
+
+	gc.createErr = nil
+	if _, err := nr.Reconcile(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	creates := gc.createCalls()
+	if len(creates) != 1 || !slices.Contains(creates[0].tags, "tracking-enabled") {
+		t.Fatalf("expected the tracking annotation on retry, got %+v", creates)
+	}
+	ns := getNamespace(t, c, "ns")
+	if ns.Annotations[TrackingAnnotation] != "enabled" || ns.Annotations[PendingAnnotation] != "" {
+		t.Fatalf("expected the state to be recorded after the annotation, got %v", ns.Annotations)
+	}
+}
+
+func TestNamespaceDeletion_CountsWorkloadsRecordedWhileActive(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	ns := trackedNamespace("ns")
+	ns.Finalizers = []string{"kubernetes"}
+	r, c := newReconciler([]client.Object{ns, deployment("api", "ns", "nginx:1.21", 1)}, gc)
+	r.Lifecycle.Adapters = []WorkloadAdapter{DeploymentAdapter{}, StatefulSetAdapter{}}
+	ctx := context.Background()
+
+	reconcileNamespace(t, r, "ns")
+	if err := c.Create(ctx, deployment("web", "ns", "nginx:1.21", 1)); err != nil {
+		t.Fatal(err)
+	}
+	reconcileNamespace(t, r, "ns")
+	if got := getNamespace(t, c, "ns").Annotations[WorkloadsAnnotation]; got != "deployment=2,statefulset=0" {
+		t.Fatalf("expected the workloads to be recorded, got %q", got)
+	}
+
+	// The namespace controller deletes the workloads before the namespace
+	// event is handled.
+	if err := c.Delete(ctx, getNamespace(t, c, "ns")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"api", "web"} {
+		if err := c.Delete(ctx, getDeployment(t, c, name, "ns")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Reconcile(ctx, reconcileReq(name, "ns")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reconcileNamespace(t, r, "ns")
+
+	creates := gc.createCalls()
+	last := creates[len(creates)-1]
+	if want := "Namespace ns deleted: 2 workloads removed (2 deployments)"; last.data != want {
+		t.Fatalf("got text %q, want %q", last.data, want)
+	}
+}
+
+func TestLabeledAt_UsesManagedFieldsOfTheLabel(t *testing.T) {
+	created := time.Date(2025, 6, 15, 9, 0, 0, 0, time.UTC)
+	entry := func(at time.Time, fields string) metav1.ManagedFieldsEntry {
+		return metav1.ManagedFieldsEntry{
+			Manager: "kubectl", Operation: metav1.ManagedFieldsOperationUpdate, Time: &metav1.Time{Time: at},
+			FieldsType: "FieldsV1", FieldsV1: &metav1.FieldsV1{Raw: []byte(fields)},
+		}
+	}
+	ns := trackedNamespace("ns")
+	ns.CreationTimestamp = metav1.NewTime(created)
+	ns.ManagedFields = []metav1.ManagedFieldsEntry{
+		entry(created.Add(time.Hour), `{"f:metadata":{"f:labels":{"f:deployment-annotator":{}}}}`),
+		entry(created.Add(2*time.Hour), `{"f:metadata":{"f:labels":{"f:team":{}}}}`),
+	}
+	if got := labeledAt(ns); !got.Equal(created.Add(time.Hour)) {
+		t.Fatalf("expected the time the label was written, got %v", got)
+	}
+	ns.ManagedFields = nil
+	if got := labeledAt(ns); !got.Equal(created) {
+		t.Fatalf("expected the creation time without managedFields, got %v", got)
+	}
+}
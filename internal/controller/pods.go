@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// listPods returns the pods selected by the workload's selector, read
+// through APIReader so pods are not cached cluster-wide. A workload without
+// a selector has no pods.
+func (r *WorkloadReconciler) listPods(ctx context.Context, obj client.Object) ([]corev1.Pod, error) {
+	var reader client.Reader = r.Client
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+	return workloadPods(ctx, reader, r.Adapter, obj)
+}
+
+// workloadPods returns the pods selected by the selector of obj, a workload
+// of adapter a.
+func workloadPods(ctx context.Context, reader client.Reader, a WorkloadAdapter, obj client.Object) ([]corev1.Pod, error) {
+	sel := a.Selector(obj)
+	if sel == nil || len(sel.MatchLabels)+len(sel.MatchExpressions) == 0 {
+		return nil, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(sel)
+	if err != nil {
+		return nil, err
+	}
+	var pods corev1.PodList
+	if err := reader.List(ctx, &pods,
+		client.InNamespace(obj.GetNamespace()), client.MatchingLabelsSelector{Selector: selector},
+	); err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// maxReasonDetail caps the detail, e.g. a scheduler message, kept per reason.
+const maxReasonDetail = 120
+
+// podFailure is one reason new pods of a stuck rollout are not ready, with
+// the number of pods affected and the first detail seen.
+type podFailure struct {
+	reason, detail string
+	pods           int
+}
+
+// podFailures is the deduplicated failure reasons of a set of pods, most
+// frequent first.
+type podFailures []podFailure
+
+// summary renders e.g. "3 pods ImagePullBackOff (registry/api:1.3); 1 pod
+// Unschedulable (0/5 nodes are available: 5 Insufficient cpu.)".
+func (f podFailures) summary() string {
+	parts := make([]string, 0, len(f))
+	for _, pf := range f {
+		s := plural(pf.pods, "pod") + " " + pf.reason
+		if pf.detail != "" {
+			s += " (" + pf.detail + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// tags returns a reason:<reason> tag per failure reason.
+func (f podFailures) tags() []string {
+	tags := make([]string, 0, len(f))
+	for _, pf := range f {
+		tags = append(tags, "reason:"+sanitizeForLog(pf.reason))
+	}
+	return tags
+}
+
+// diagnosePods returns why the pods of obj's current revision are not
+// ready.
+func (r *WorkloadReconciler) diagnosePods(ctx context.Context, obj client.Object) podFailures {
+	pods, err := r.currentPods(ctx, obj)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list pods of stuck rollout", "kind", r.Adapter.Kind())
+		return nil
+	}
+	return failureReasons(pods)
+}
+
+// currentPods returns the pods of obj's current revision. Pods of older
+// revisions are left out; when the current revision is unknown all pods are
+// returned.
+func (r *WorkloadReconciler) currentPods(ctx context.Context, obj client.Object) ([]corev1.Pod, error) {
+	pods, err := r.listPods(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	return revisionPods(ctx, r.Client, r.Adapter, obj, pods), nil
+}
+
+// revisionPods returns the pods of obj's current revision among pods, or all
+// of them when the current revision is unknown.
+func revisionPods(ctx context.Context, c client.Client, a WorkloadAdapter, obj client.Object, pods []corev1.Pod) []corev1.Pod {
+	var rev *Revision
+	if history, err := a.History(ctx, c, obj); err == nil {
+		rev = currentRevision(history, a.PodTemplate(obj))
+	}
+	var current []corev1.Pod
+	for _, pod := range pods {
+		if rev == nil || podOfRevision(&pod, rev) {
+			current = append(current, pod)
+		}
+	}
+	return current
+}
+
+// podOfRevision reports whether pod was created from rev, by the template
+// hash label the workload controllers put on their pods.
+func podOfRevision(pod *corev1.Pod, rev *Revision) bool {
+	hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+	if hash == "" {
+		hash = pod.Labels[appsv1.ControllerRevisionHashLabelKey]
+	}
+	return hash != "" && (rev.Name == hash || strings.HasSuffix(rev.Name, "-"+hash))
+}
+
+// failureReasons collects the reasons pods are not ready: an unschedulable
+// pod, containers waiting for something other than their start (image pull
+// errors, crash loops, config errors), and running containers failing their
+// readiness probe. Each pod counts once per reason.
+func failureReasons(pods []corev1.Pod) podFailures {
+	byReason := map[string]*podFailure{}
+	var order []string
+	add := func(seen map[string]bool, reason, detail string) {
+		if seen[reason] {
+			return
+		}
+		seen[reason] = true
+		pf := byReason[reason]
+		if pf == nil {
+			if len(detail) > maxReasonDetail {
+				cut := maxReasonDetail
+				for cut > 0 && !utf8.RuneStart(detail[cut]) {
+					cut--
+				}
+				detail = detail[:cut] + "…"
+			}
+			pf = &podFailure{reason: reason, detail: detail}
+			byReason[reason] = pf
+			order = append(order, reason)
+		}
+		pf.pods++
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, c := range pod.Status.Conditions {
+			if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse && c.Reason == corev1.PodReasonUnschedulable {
+				add(seen, c.Reason, c.Message)
+			}
+		}
+		probes := map[string]bool{}
+		for _, c := range pod.Spec.Containers {
+			probes[c.Name] = c.ReadinessProbe != nil
+		}
+		statuses := append(slices.Clone(pod.Status.InitContainerStatuses), pod.Status.ContainerStatuses...)
+		for _, cs := range statuses {
+			switch {
+			case cs.State.Waiting != nil:
+				w := cs.State.Waiting
+				if w.Reason == "" || w.Reason == "ContainerCreating" || w.Reason == "PodInitializing" {
+					continue
+				}
+				detail := w.Message
+				switch {
+				case strings.Contains(w.Reason, "Image"):
+					detail = cs.Image
+				case w.Reason == "CrashLoopBackOff" && cs.LastTerminationState.Terminated != nil:
+					t := cs.LastTerminationState.Terminated
+					detail = fmt.Sprintf("last exit %d %s", t.ExitCode, t.Reason)
+				}
+				add(seen, w.Reason, strings.TrimSpace(detail))
+			case cs.State.Running != nil && !cs.Ready && probes[cs.Name]:
+				add(seen, "ReadinessProbeFailing", cs.Name)
+			}
+		}
+	}
+	out := make(podFailures, 0, len(order))
+	for _, reason := range order {
+		out = append(out, *byReason[reason])
+	}
+	slices.SortStableFunc(out, func(a, b podFailure) int { return cmp.Compare(b.pods, a.pods) })
+	return out
+}
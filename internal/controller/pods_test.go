@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestReconcile_Timeout_ReportsPodFailureReasons(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := deployment("app", "ns", "registry/api:1.3", 1)
+	d.UID = "app-uid"
+	d.Annotations = map[string]string{
+		VersionAnnotation:   "hash-app-new-img-1.3",
+		StartAnnotation:     "100",
+		StartTimeAnnotation: now.Add(-20 * time.Minute).Format(time.RFC3339),
+	}
+	rs := controlledReplicaSet(d, "app-new", "2", now.Add(-20*time.Minute))
+	pod := func(name, hash string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "ns", Labels: map[string]string{"app": "app", "pod-template-hash": hash},
+		}}
+	}
+	pulling := func(name string) *corev1.Pod {
+		p := pod(name, "new")
+		p.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name: "main", Image: "registry/api:1.3",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+				Reason: "ImagePullBackOff", Message: "Back-off pulling image",
+			}},
+		}}
+		return p
+	}
+	pending := pod("app-new-3", "new")
+	pending.Status.Conditions = []corev1.PodCondition{{
+		Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable,
+		Message: "0/5 nodes are available: 5 Insufficient cpu.",
+	}}
+	old := pod("app-old-1", "old")
+	old.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "main",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+	}}
+	r, _ := newReconciler([]client.Object{
+		trackedNamespace("ns"), d, rs, pulling("app-new-1"), pulling("app-new-2"), pending, old,
+	}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+	r.Deadline = 10 * time.Minute
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	creates := gc.createCalls()
+	if len(creates) != 1 {
+		t.Fatalf("expected a timed-out annotation, got %+v", creates)
+	}
+	want := "Deployment registry/api:1.3 not ready after 10m0s — 2 pods ImagePullBackOff (registry/api:1.3); " +
+		"1 pod Unschedulable (0/5 nodes are available: 5 Insufficient cpu.)"
+	if creates[0].data != want {
+		t.Fatalf("expected %q, got %q", want, creates[0].data)
+	}
+	for _, tags := range [][]string{creates[0].tags, gc.regionCalls()[0].tags} {
+		if !slices.Contains(tags, "reason:ImagePullBackOff") || !slices.Contains(tags, "reason:Unschedulable") ||
+			slices.Contains(tags, "reason:CrashLoopBackOff") {
+			t.Fatalf("expected reason tags of the new pods only, got %v", tags)
+		}
+	}
+}
+
+func TestFailureReasons_CrashLoopAndReadiness(t *testing.T) {
+	pod := corev1.Pod{
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "main"}, {Name: "sidecar", ReadinessProbe: &corev1.Probe{}},
+		}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "main", State: corev1.ContainerState{
+				Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+			}, LastTerminationState: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"},
+			}},
+			{Name: "sidecar", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+		}},
+	}
+	got := failureReasons([]corev1.Pod{pod, pod}).summary()
+	want := "2 pods CrashLoopBackOff (last exit 137 OOMKilled); 2 pods ReadinessProbeFailing (sidecar)"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestReconcile_ProgressDeadlineExceeded_DiagnosedWithoutDeadline(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	startedAt := now.Add(-20 * time.Minute)
+	d := deployment("app", "ns", "registry/api:1.3", 1)
+	d.Annotations = map[string]string{
+		VersionAnnotation:   "hash-app-new-img-1.3",
+		StartAnnotation:     "100",
+		StartTimeAnnotation: startedAt.Format(time.RFC3339),
+	}
+	d.Status.Conditions = []appsv1.DeploymentCondition{{
+		Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded",
+		LastUpdateTime: metav1.NewTime(startedAt.Add(10 * time.Minute)),
+	}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: "app-new-1", Namespace: "ns", Labels: map[string]string{"app": "app", "pod-template-hash": "new"},
+	}}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "main",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+	}}
+	r, _ := newReconciler([]client.Object{
+		trackedNamespace("ns"), d, controlledReplicaSet(d, "app-new", "2", startedAt), pod,
+	}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	creates := gc.createCalls()
+	if len(creates) != 1 {
+		t.Fatalf("expected a timed-out annotation, got %+v", creates)
+	}
+	want := "Deployment registry/api:1.3 not ready after 10m0s — 1 pod CrashLoopBackOff"
+	if creates[0].data != want || !slices.Contains(creates[0].tags, "reason:CrashLoopBackOff") {
+		t.Fatalf("expected %q tagged with the reason, got %q %v", want, creates[0].data, creates[0].tags)
+	}
+}
+
+func TestSpecChangedPredicate_DeploymentStallTriggersReconcile(t *testing.T) {
+	pred := specChangedPredicate(DeploymentAdapter{})
+	progressing := deployment("app", "ns", "registry/api:1.3", 2)
+	progressing.Status.Conditions = []appsv1.DeploymentCondition{{
+		Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue, Reason: "ReplicaSetUpdated",
+	}}
+	scaled := progressing.DeepCopy()
+	scaled.Status.AvailableReplicas = 1
+	stalled := progressing.DeepCopy()
+	stalled.Status.Conditions[0].Status = corev1.ConditionFalse
+	stalled.Status.Conditions[0].Reason = "ProgressDeadlineExceeded"
+	restalled := stalled.DeepCopy()
+	restalled.Status.ObservedGeneration = 2
+
+	for _, tc := range []struct {
+		name     string
+		old, new *appsv1.Deployment
+		want     bool
+	}{
+		{"status change", progressing, scaled, false},
+		{"stall", progressing, stalled, true},
+		{"still stalled", stalled, restalled, false},
+	} {
+		if got := pred.Update(event.UpdateEvent{ObjectOld: tc.old, ObjectNew: tc.new}); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestFailureReasons_TruncatesDetailOnRuneBoundary(t *testing.T) {
+	pod := corev1.Pod{Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{
+		Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable,
+		Message: strings.Repeat("a", maxReasonDetail-1) + "äöü",
+	}}}}
+	got := failureReasons([]corev1.Pod{pod})[0].detail
+	want := strings.Repeat("a", maxReasonDetail-1) + "…"
+	if got != want || !utf8.ValidString(got) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// maxPromotionImages bounds the images remembered per namespace in
+// PromotionsAnnotation; the oldest completions are dropped first.
+const maxPromotionImages = 100
+
+// promotion is a rollout of an image that already completed in the previous
+// environment of PromotionOrder.
+type promotion struct {
+	from, to string
+	lead     time.Duration // from the first completion in from to the rollout start
+}
+
+func (p *promotion) summary() string {
+	if p == nil {
+		return ""
+	}
+	return fmt.Sprintf("promoted from %s after %s", p.from, formatLeadTime(p.lead))
+}
+
+// observe exports the lead time of p; a nil promotion is ignored.
+func (p *promotion) observe(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	promotionLeadTime.WithLabelValues(p.from, p.to).Observe(p.lead.Seconds())
+	log.FromContext(ctx).Info("Rollout promoted", "from", sanitizeForLog(p.from), "leadTime", p.lead)
+}
+
+// imageIdentity identifies an image across environments: its digest when
+// the reference pins one, else the whole reference.
+func imageIdentity(imageRef string) string {
+	if at := strings.LastIndex(imageRef, "@"); at != -1 {
+		return imageRef[at+1:]
+	}
+	return imageRef
+}
+
+// resolveImage returns the identity of imageRef as run by obj, a workload
+// of kind: the digest the reference pins, else the digest the pods of the
+// current revision report in status.containerStatuses[].imageID, so two
+// builds pushed under one tag are told apart. Without a digest it falls
+// back to imageIdentity. Empty when promotions are not tracked.
+func (l *AnnotationLifecycle) resolveImage(ctx context.Context, obj client.Object, kind, imageRef string) string {
+	if l.EnvironmentLabel == "" || imageRef == "" {
+		return ""
+	}
+	a := adapterFor(kind)
+	if a == nil || strings.Contains(imageRef, "@") {
+		return imageIdentity(imageRef)
+	}
+	pods, err := workloadPods(ctx, l.reader(), a, obj)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list pods for image digest", "kind", kind)
+		return imageIdentity(imageRef)
+	}
+	for _, pod := range revisionPods(ctx, l.Client, a, obj, pods) {
+		if digest := podImageDigest(&pod, imageRef); digest != "" {
+			return digest
+		}
+	}
+	return imageIdentity(imageRef)
+}
+
+// podImageDigest returns the digest pod runs for its container with image
+// imageRef, or "" when the runtime has not reported one yet.
+func podImageDigest(pod *corev1.Pod, imageRef string) string {
+	if pod.DeletionTimestamp != nil {
+		return ""
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.Image != imageRef {
+			continue
+		}
+		for _, st := range pod.Status.ContainerStatuses {
+			if at := strings.LastIndex(st.ImageID, "@"); st.Name == c.Name && at != -1 {
+				return st.ImageID[at+1:]
+			}
+		}
+	}
+	return ""
+}
+
+// formatLeadTime renders d to the minute, e.g. "3h12m".
+func formatLeadTime(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	s := d.Round(time.Minute).String()
+	return strings.TrimSuffix(s, "0s")
+}
+
+// parsePromotions decodes PromotionsAnnotation. A malformed value is treated
+// as empty.
+func parsePromotions(value string) map[string]time.Time {
+	completions := map[string]time.Time{}
+	if value != "" && json.Unmarshal([]byte(value), &completions) != nil {
+		return map[string]time.Time{}
+	}
+	return completions
+}
+
+// environment returns the environment ns belongs to and its position in
+// PromotionOrder, or -1 when promotions into or out of it are not tracked.
+func (l *AnnotationLifecycle) environment(ns *corev1.Namespace) (string, int) {
+	if l.EnvironmentLabel == "" {
+		return "", -1
+	}
+	env := ns.Labels[l.EnvironmentLabel]
+	if env == "" {
+		return "", -1
+	}
+	return env, slices.Index(l.PromotionOrder, env)
+}
+
+// promotedFrom returns the promotion a rollout of image, as returned by
+// resolveImage, starting at startedAt in obj's namespace is, or nil when the
+// image did not complete in the previous environment before.
+func (l *AnnotationLifecycle) promotedFrom(
+	ctx context.Context, obj client.Object, image string, startedAt time.Time,
+) *promotion {
+	if l.EnvironmentLabel == "" || image == "" {
+		return nil
+	}
+	var ns corev1.Namespace
+	if err := l.Client.Get(ctx, client.ObjectKey{Name: obj.GetNamespace()}, &ns); err != nil {
+		return nil
+	}
+	env, i := l.environment(&ns)
+	if i <= 0 {
+		return nil
+	}
+	from := l.PromotionOrder[i-1]
+	var sources corev1.NamespaceList
+	if err := l.Client.List(ctx, &sources, client.MatchingLabels{l.EnvironmentLabel: from}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list namespaces of environment", "environment", sanitizeForLog(from))
+		return nil
+	}
+	var first time.Time
+	for _, src := range sources.Items {
+		t, ok := parsePromotions(src.Annotations[PromotionsAnnotation])[image]
+		if ok && !t.After(startedAt) && (first.IsZero() || t.Before(first)) {
+			first = t
+		}
+	}
+	if first.IsZero() {
+		return nil
+	}
+	return &promotion{from: from, to: env, lead: startedAt.Sub(first)}
+}
+
+// recordPromotion remembers on the namespace when image, as returned by
+// resolveImage, first completed a rollout there, so rollouts in the next
+// environment can measure their promotion lead time.
+func (l *AnnotationLifecycle) recordPromotion(ctx context.Context, obj client.Object, image string, completedAt time.Time) {
+	if l.EnvironmentLabel == "" || image == "" {
+		return
+	}
+	logger := log.FromContext(ctx)
+	var reader client.Reader = l.Client
+	for attempt := 0; attempt < 3; attempt++ {
+		var ns corev1.Namespace
+		if err := reader.Get(ctx, client.ObjectKey{Name: obj.GetNamespace()}, &ns); err != nil {
+			return
+		}
+		if _, i := l.environment(&ns); i < 0 || i == len(l.PromotionOrder)-1 {
+			return
+		}
+		completions := parsePromotions(ns.Annotations[PromotionsAnnotation])
+		if _, ok := completions[image]; ok {
+			return
+		}
+		completions[image] = completedAt.UTC()
+		for len(completions) > maxPromotionImages {
+			oldest := image
+			for k, t := range completions {
+				if t.Before(completions[oldest]) {
+					oldest = k
+				}
+			}
+			delete(completions, oldest)
+		}
+		b, err := json.Marshal(completions)
+		if err != nil {
+			return
+		}
+		err = l.patchAnnotations(ctx, &ns, map[string]string{PromotionsAnnotation: string(b)})
+		if apierrors.IsConflict(err) {
+			// The cache may still hold the namespace that conflicted.
+			reader = l.reader()
+			continue
+		}
+		if err != nil {
+			logger.Error(err, "Failed to record image completion", "namespace", sanitizeForLog(ns.Name))
+		}
+		return
+	}
+}
@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestReconcile_Promotion_AnnotatesLeadTime(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	image := "shop@sha256:0123456789abcdef"
+	environment := func(name, env string) *corev1.Namespace {
+		ns := trackedNamespace(name)
+		ns.Labels["environment"] = env
+		return ns
+	}
+	staged := readyDeployment("api", "shop-staging", image, 1)
+	staged.Annotations = map[string]string{VersionAnnotation: "gen-1-img-0123456", StartAnnotation: "100"}
+	prod := deployment("api", "shop-prod", image, 2)
+	prod.Annotations = map[string]string{VersionAnnotation: "gen-1-img-old"}
+	r, c := newReconciler([]client.Object{
+		environment("shop-staging", "staging"), environment("shop-prod", "prod"), staged, prod,
+	}, gc)
+	now := time.Date(2025, 6, 15, 9, 0, 0, 0, time.UTC)
+	r.Lifecycle.Now = func() time.Time { return now }
+	r.Lifecycle.EnvironmentLabel = "environment"
+	r.Lifecycle.PromotionOrder = []string{"staging", "prod"}
+	ctx := context.Background()
+
+	if _, err := r.Reconcile(ctx, reconcileReq("api", "shop-staging")); err != nil {
+		t.Fatal(err)
+	}
+	var ns corev1.Namespace
+	if err := c.Get(ctx, client.ObjectKey{Name: "shop-staging"}, &ns); err != nil {
+		t.Fatal(err)
+	}
+	if got := parsePromotions(ns.Annotations[PromotionsAnnotation]); !got["sha256:0123456789abcdef"].Equal(now) {
+		t.Fatalf("expected the staging completion to be recorded, got %v", got)
+	}
+
+	now = now.Add(3*time.Hour + 12*time.Minute)
+	if _, err := r.Reconcile(ctx, reconcileReq("api", "shop-prod")); err != nil {
+		t.Fatal(err)
+	}
+	creates := gc.createCalls()
+	start := creates[len(creates)-1]
+	if start.what != "deploy-start:api" || !strings.Contains(start.data, "promoted from staging after 3h12m") ||
+		!slices.Contains(start.tags, "promoted-from:staging") {
+		t.Fatalf("expected the prod start annotated as a promotion, got %+v", start)
+	}
+}
+
+func TestFormatLeadTime(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		42 * time.Second: "42s",
+		3*time.Hour + 12*time.Minute + 20*time.Second: "3h12m",
+		5 * time.Minute: "5m",
+	} {
+		if got := formatLeadTime(d); got != want {
+			t.Errorf("formatLeadTime(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestReconcile_Promotion_MatchesTaggedImagesByPodDigest(t *testing.T) {
+	for _, tc := range []struct {
+		name, prodDigest string
+		promoted         bool
+	}{
+		{"same build", "sha256:aaaa", true},
+		{"another build under the tag", "sha256:bbbb", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gc := &fakeAnnotationClient{}
+			image := "shop:latest"
+			environment := func(name, env string) *corev1.Namespace {
+				ns := trackedNamespace(name)
+				ns.Labels["environment"] = env
+				return ns
+			}
+			pod := func(namespace, digest string) *corev1.Pod {
+				return &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: "api-1", Namespace: namespace, Labels: map[string]string{"app": "api"}},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: image}}},
+					Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+						Name: "main", Image: "docker.io/library/" + image, ImageID: "docker.io/library/shop@" + digest,
+					}}},
+				}
+			}
+			staged := readyDeployment("api", "shop-staging", image, 1)
+			staged.Annotations = map[string]string{VersionAnnotation: "gen-1-img-latest", StartAnnotation: "100"}
+			prod := deployment("api", "shop-prod", image, 2)
+			prod.Annotations = map[string]string{VersionAnnotation: "gen-1-img-old"}
+			r, c := newReconciler([]client.Object{
+				environment("shop-staging", "staging"), environment("shop-prod", "prod"), staged, prod,
+				pod("shop-staging", "sha256:aaaa"),
+			}, gc)
+			now := time.Date(2025, 6, 15, 9, 0, 0, 0, time.UTC)
+			r.Lifecycle.Now = func() time.Time { return now }
+			r.Lifecycle.EnvironmentLabel = "environment"
+			r.Lifecycle.PromotionOrder = []string{"staging", "prod"}
+			ctx := context.Background()
+
+			if _, err := r.Reconcile(ctx, reconcileReq("api", "shop-staging")); err != nil {
+				t.Fatal(err)
+			}
+			var ns corev1.Namespace
+			if err := c.Get(ctx, client.ObjectKey{Name: "shop-staging"}, &ns); err != nil {
+				t.Fatal(err)
+			}
+			if got := parsePromotions(ns.Annotations[PromotionsAnnotation]); !got["sha256:aaaa"].Equal(now) {
+				t.Fatalf("expected the staging completion recorded by digest, got %v", got)
+			}
+
+			// The prod pods only report their digest once the rollout is under way.
+			now = now.Add(time.Hour)
+			if _, err := r.Reconcile(ctx, reconcileReq("api", "shop-prod")); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Create(ctx, pod("shop-prod", tc.prodDigest)); err != nil {
+				t.Fatal(err)
+			}
+			got := getDeployment(t, c, "api", "shop-prod")
+			got.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1, ObservedGeneration: 2}
+			if err := c.Status().Update(ctx, got); err != nil {
+				t.Fatal(err)
+			}
+			now = now.Add(5 * time.Minute)
+			if _, err := r.Reconcile(ctx, reconcileReq("api", "shop-prod")); err != nil {
+				t.Fatal(err)
+			}
+			creates := gc.createCalls()
+			end := creates[len(creates)-1]
+			promoted := strings.Contains(end.data, "promoted from staging after 1h0m") &&
+				slices.Contains(end.tags, "promoted-from:staging")
+			if end.what != "deploy-end:api" || promoted != tc.promoted {
+				t.Fatalf("expected promoted=%v on the completion, got %+v", tc.promoted, end)
+			}
+		})
+	}
+}
+
+func TestRecordPromotion_ConflictRereadsUncached(t *testing.T) {
+	staging := trackedNamespace("shop-staging")
+	staging.Labels["environment"] = "staging"
+	api := fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(staging).Build()
+	ctx := context.Background()
+	var stale corev1.Namespace
+	if err := api.Get(ctx, client.ObjectKey{Name: "shop-staging"}, &stale); err != nil {
+		t.Fatal(err)
+	}
+	// Another writer updates the namespace; the cache has not seen it yet.
+	fresh := stale.DeepCopy()
+	fresh.Annotations = map[string]string{"team": "shop"}
+	if err := api.Update(ctx, fresh); err != nil {
+		t.Fatal(err)
+	}
+	cached := interceptor.NewClient(api, interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if ns, ok := obj.(*corev1.Namespace); ok {
+				stale.DeepCopyInto(ns)
+				return nil
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+	})
+	l := &AnnotationLifecycle{
+		Client: cached, APIReader: api,
+		EnvironmentLabel: "environment", PromotionOrder: []string{"staging", "prod"},
+	}
+	now := time.Date(2025, 6, 15, 9, 0, 0, 0, time.UTC)
+	d := readyDeployment("api", "shop-staging", "shop@sha256:aaaa", 1)
+
+	l.recordPromotion(ctx, d, "sha256:aaaa", now)
+
+	var got corev1.Namespace
+	if err := api.Get(ctx, client.ObjectKey{Name: "shop-staging"}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !parsePromotions(got.Annotations[PromotionsAnnotation])["sha256:aaaa"].Equal(now) || got.Annotations["team"] != "shop" {
+		t.Fatalf("expected the completion recorded after re-reading the namespace, got %v", got.Annotations)
+	}
+}
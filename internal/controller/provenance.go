@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Well-known metadata written by deployment tools.
+const (
+	changeCauseAnnotation  = "kubernetes.io/change-cause"
+	argoTrackingAnnotation = "argocd.argoproj.io/tracking-id"
+	fluxKustomizationName  = "kustomize.toolkit.fluxcd.io/name"
+	fluxKustomizationNS    = "kustomize.toolkit.fluxcd.io/namespace"
+	fluxHelmReleaseName    = "helm.toolkit.fluxcd.io/name"
+	fluxHelmReleaseNS      = "helm.toolkit.fluxcd.io/namespace"
+	helmReleaseAnnotation  = "meta.helm.sh/release-name"
+	helmChartLabel         = "helm.sh/chart"
+	instanceLabel          = "app.kubernetes.io/instance"
+	defaultArgoCDNamespace = "argocd"
+	gitOpsLookupTimeout    = 10 * time.Second
+)
+
+var (
+	argoApplicationGVK   = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Application"}
+	fluxKustomizationGVK = schema.GroupVersionKind{Group: "kustomize.toolkit.fluxcd.io", Version: "v1", Kind: "Kustomization"}
+	fluxHelmReleaseGVK   = schema.GroupVersionKind{Group: "helm.toolkit.fluxcd.io", Version: "v2", Kind: "HelmRelease"}
+)
+
+// provenance describes who or what triggered a rollout.
+type provenance struct {
+	tool        string // helm, argocd, flux, kubectl, or the field manager name
+	manager     string // field manager that last wrote the pod template
+	source      string // Helm release, Argo CD Application or Flux object
+	revision    string // GitOps revision or chart, when known
+	changeCause string // kubernetes.io/change-cause
+	user        string // authenticated user, from the attribution webhook
+}
+
+// tags returns trigger:<tool>, manager:<name> when it adds information, and
+// user:<name> when the user is known.
+func (p provenance) tags() []string {
+	var tags []string
+	if p.tool != "" {
+		tags = append(tags, "trigger:"+sanitizeForLog(p.tool))
+	}
+	if p.manager != "" && p.manager != p.tool {
+		tags = append(tags, "manager:"+sanitizeForLog(p.manager))
+	}
+	if p.user != "" {
+		tags = append(tags, "user:"+sanitizeForLog(p.user))
+	}
+	return tags
+}
+
+// summary renders e.g. "triggered by argocd (shop@1a2b3c4); change-cause: bump"
+// or "triggered by alice via kubectl".
+func (p provenance) summary() string {
+	if p.tool == "" && p.user == "" && p.changeCause == "" {
+		return ""
+	}
+	var parts []string
+	if p.tool != "" || p.user != "" {
+		s := "triggered by " + cmp.Or(p.user, p.tool)
+		if p.user != "" && p.tool != "" {
+			s += " via " + p.tool
+		}
+		if src := p.source; src != "" {
+			if p.revision != "" {
+				src += "@" + p.revision
+			}
+			s += " (" + src + ")"
+		}
+		parts = append(parts, s)
+	}
+	if p.changeCause != "" {
+		parts = append(parts, "change-cause: "+p.changeCause)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// provenance derives what triggered the current rollout of obj from the
+// field manager of its pod template, kubernetes.io/change-cause, and the
+// metadata Helm, Argo CD and Flux leave on the objects they manage. With
+// GitOpsLookup the revision is read from the Argo CD Application or Flux
+// object; lookup failures are ignored.
+func (l *AnnotationLifecycle) provenance(ctx context.Context, obj client.Object) provenance {
+	labels := obj.GetLabels()
+	annotations := obj.GetAnnotations()
+	p := provenance{
+		manager:     templateManager(obj),
+		changeCause: annotations[changeCauseAnnotation],
+	}
+	p.tool = toolForManager(p.manager)
+
+	var lookup *client.ObjectKey
+	var gvk schema.GroupVersionKind
+	var revisionPath []string
+	switch {
+	case annotations[argoTrackingAnnotation] != "":
+		// <app>:<group>/<kind>:<namespace>/<name>, where <app> may be <namespace>_<name>.
+		app, _, _ := strings.Cut(annotations[argoTrackingAnnotation], ":")
+		key := client.ObjectKey{Namespace: l.argoCDNamespace(), Name: app}
+		if ns, name, ok := strings.Cut(app, "_"); ok {
+			key = client.ObjectKey{Namespace: ns, Name: name}
+		}
+		p.tool = cmp.Or(p.tool, "argocd")
+		p.source = app
+		lookup, gvk, revisionPath = &key, argoApplicationGVK, []string{"status", "sync", "revision"}
+	case labels[fluxKustomizationName] != "":
+		key := client.ObjectKey{Namespace: labels[fluxKustomizationNS], Name: labels[fluxKustomizationName]}
+		p.tool = cmp.Or(p.tool, "flux")
+		p.source = key.String()
+		lookup, gvk, revisionPath = &key, fluxKustomizationGVK, []string{"status", "lastAppliedRevision"}
+	case labels[fluxHelmReleaseName] != "":
+		key := client.ObjectKey{Namespace: labels[fluxHelmReleaseNS], Name: labels[fluxHelmReleaseName]}
+		p.tool = cmp.Or(p.tool, "flux")
+		p.source = key.String()
+		lookup, gvk, revisionPath = &key, fluxHelmReleaseGVK, []string{"status", "lastAttemptedRevision"}
+	case annotations[helmReleaseAnnotation] != "":
+		p.tool = cmp.Or(p.tool, "helm")
+		p.source = annotations[helmReleaseAnnotation]
+		p.revision = labels[helmChartLabel]
+	}
+	if p.tool == "" {
+		p.tool = p.manager
+	}
+
+	if l.GitOpsLookup && lookup != nil {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		lctx, cancel := context.WithTimeout(ctx, gitOpsLookupTimeout)
+		defer cancel()
+		if err := l.Client.Get(lctx, *lookup, u); err != nil {
+			log.FromContext(ctx).V(1).Info("Cannot read GitOps revision",
+				"kind", gvk.Kind, "object", lookup.String(), "error", err.Error())
+		} else if rev, _, _ := unstructured.NestedString(u.Object, revisionPath...); rev != "" {
+			p.revision = shortRevision(rev)
+		}
+	}
+	return p
+}
+
+func (l *AnnotationLifecycle) argoCDNamespace() string {
+	return cmp.Or(l.ArgoCDNamespace, defaultArgoCDNamespace)
+}
+
+// templateManager returns the field manager that most recently wrote
+// spec.template, or "" when managedFields are not available.
+func templateManager(obj client.Object) string {
+	var manager string
+	var latest time.Time
+	for _, mf := range obj.GetManagedFields() {
+		if mf.Subresource != "" || mf.FieldsV1 == nil {
+			continue
+		}
+		var fields struct {
+			Spec map[string]json.RawMessage `json:"f:spec"`
+		}
+		if err := json.Unmarshal(mf.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		if _, ok := fields.Spec["f:template"]; !ok {
+			continue
+		}
+		var t time.Time
+		if mf.Time != nil {
+			t = mf.Time.Time
+		}
+		if manager == "" || !t.Before(latest) {
+			manager, latest = mf.Manager, t
+		}
+	}
+	return manager
+}
+
+// toolForManager maps well-known field manager names to a tool.
+func toolForManager(manager string) string {
+	switch {
+	case manager == "helm":
+		return "helm"
+	case strings.HasPrefix(manager, "kubectl"):
+		return "kubectl"
+	case strings.HasPrefix(manager, "argocd"):
+		return "argocd"
+	case manager == "kustomize-controller", manager == "helm-controller":
+		return "flux"
+	}
+	return ""
+}
+
+// shortRevision shortens Git SHAs in revisions such as "main@sha1:<sha>" or a bare SHA.
+func shortRevision(rev string) string {
+	prefix, sha := "", rev
+	if i := strings.LastIndex(rev, ":"); i != -1 {
+		prefix, sha = rev[:i+1], rev[i+1:]
+	}
+	if len(sha) == 40 || len(sha) == 64 {
+		return fmt.Sprintf("%s%s", prefix, sha[:7])
+	}
+	return rev
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func managedFields(manager string, at time.Time, fields string) metav1.ManagedFieldsEntry {
+	return metav1.ManagedFieldsEntry{
+		Manager:    manager,
+		Operation:  metav1.ManagedFieldsOperationUpdate,
+		Time:       &metav1.Time{Time: at},
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(fields)},
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	template := `{"f:spec":{"f:template":{"f:spec":{}}}}`
+	replicas := `{"f:spec":{"f:replicas":{}}}`
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		labels      map[string]string
+		fields      []metav1.ManagedFieldsEntry
+		wantTags    []string
+		wantSummary string
+	}{
+		{
+			name: "kubectl edit wins over older helm apply",
+			fields: []metav1.ManagedFieldsEntry{
+				managedFields("helm", t0, template),
+				managedFields("kubectl-edit", t0.Add(time.Hour), template),
+				managedFields("hpa", t0.Add(2*time.Hour), replicas),
+			},
+			annotations: map[string]string{changeCauseAnnotation: "hotfix"},
+			wantTags:    []string{"trigger:kubectl", "manager:kubectl-edit"},
+			wantSummary: "triggered by kubectl; change-cause: hotfix",
+		},
+		{
+			name:        "argo cd tracking id",
+			fields:      []metav1.ManagedFieldsEntry{managedFields("argocd-controller", t0, template)},
+			annotations: map[string]string{argoTrackingAnnotation: "shop:apps/Deployment:ns/api"},
+			wantTags:    []string{"trigger:argocd", "manager:argocd-controller"},
+			wantSummary: "triggered by argocd (shop)",
+		},
+		{
+			name: "flux kustomization without managed fields",
+			labels: map[string]string{
+				fluxKustomizationName: "apps",
+				fluxKustomizationNS:   "flux-system",
+			},
+			wantTags:    []string{"trigger:flux"},
+			wantSummary: "triggered by flux (flux-system/apps)",
+		},
+		{
+			name:        "unknown manager",
+			fields:      []metav1.ManagedFieldsEntry{managedFields("my-operator", t0, template)},
+			wantTags:    []string{"trigger:my-operator"},
+			wantSummary: "triggered by my-operator",
+		},
+		{
+			name: "nothing known",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := deployment("api", "ns", "nginx:1.22", 1)
+			d.Annotations = tt.annotations
+			d.Labels = tt.labels
+			d.ManagedFields = tt.fields
+			p := (&AnnotationLifecycle{}).provenance(context.Background(), d)
+			if got := p.tags(); !slices.Equal(got, tt.wantTags) {
+				t.Errorf("tags = %v, want %v", got, tt.wantTags)
+			}
+			if got := p.summary(); got != tt.wantSummary {
+				t.Errorf("summary = %q, want %q", got, tt.wantSummary)
+			}
+		})
+	}
+}
+
+func TestShortRevision(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	for in, want := range map[string]string{
+		sha:                "0123456",
+		"main@sha1:" + sha: "main@sha1:0123456",
+		"1.4.0":            "1.4.0",
+		"main@sha1:abc":    "main@sha1:abc",
+	} {
+		if got := shortRevision(in); got != want {
+			t.Errorf("shortRevision(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
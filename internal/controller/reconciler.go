@@ -2,10 +2,12 @@ package controller
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -20,15 +22,80 @@ const (
 	StartAnnotation   = "deployment-annotator.io/start-annotation-id"
 	EndAnnotation     = "deployment-annotator.io/end-annotation-id"
 	VersionAnnotation = "deployment-annotator.io/tracked-version"
+	// MilestonesAnnotation lists the rollout milestones already annotated
+	// for the current version, comma-separated.
+	MilestonesAnnotation = "deployment-annotator.io/milestones"
+	// StartTimeAnnotation records when the current rollout started (RFC 3339).
+	StartTimeAnnotation = "deployment-annotator.io/start-time"
+	// TimedOutAnnotation is set while a rollout closed as timed-out still
+	// waits for a late completion.
+	TimedOutAnnotation = "deployment-annotator.io/timed-out"
+	// DeadlineAnnotation is set by users to override the per-kind rollout
+	// deadline of one workload: a Go duration ("15m") or seconds ("900").
+	// "0" disables the deadline.
+	DeadlineAnnotation = "deployment-annotator.io/rollout-deadline"
+	// ChangeAnnotation lists the change categories of the current rollout,
+	// comma-separated (see classifyChange).
+	ChangeAnnotation = "deployment-annotator.io/change"
+	// TriggerAnnotation lists the trigger tags of the current rollout
+	// (trigger:<tool>, manager:<name>), comma-separated.
+	TriggerAnnotation = "deployment-annotator.io/trigger"
+	// PendingAnnotation holds the idempotency key of an annotation that is
+	// being created; see createOnce.
+	PendingAnnotation = "deployment-annotator.io/pending"
+	// TrackingAnnotation is set to "enabled" on a namespace once tracking
+	// being enabled was annotated, and cleared when disabling was annotated.
+	// The value is "deleted" once the deletion of the namespace was annotated.
+	TrackingAnnotation = "deployment-annotator.io/tracking"
+	// WorkloadsAnnotation records on a tracked namespace how many workloads
+	// of each kind it holds, e.g. "deployment=2,statefulset=1", so the
+	// namespace deletion annotation does not depend on how many were already
+	// deleted when it is created.
+	WorkloadsAnnotation = "deployment-annotator.io/workloads"
+	// PromotionsAnnotation records on a namespace when each image first
+	// completed a rollout there, as a JSON object of image digest (or
+	// reference) to time; see recordPromotion.
+	PromotionsAnnotation = "deployment-annotator.io/promotions"
+	// DeletingAnnotation stores the ID of the annotation created when a
+	// workload held by DeletionFinalizer started deleting.
+	DeletingAnnotation = "deployment-annotator.io/deleting-annotation-id"
+	// BurstAnnotation names the burst an aggregated rollout belongs to while
+	// it is in progress (see BurstAggregator).
+	BurstAnnotation = "deployment-annotator.io/burst"
+	// ReleaseAnnotation stores the ID of the Helm release region a rollout
+	// in progress belongs to.
+	ReleaseAnnotation = "deployment-annotator.io/release-annotation-id"
+	// WatchAnnotation is set while a completed rollout is in its post-deploy
+	// watch window: the window end (RFC 3339), then the container restarts
+	// counted at the first check, comma-separated.
+	WatchAnnotation = "deployment-annotator.io/watch"
+	// DipAnnotation is set while the availability of a rolling workload is
+	// below what its update strategy allows: when the dip started (RFC 3339),
+	// the lowest available and the desired replicas, and the minimum allowed.
+	DipAnnotation = "deployment-annotator.io/availability-dip"
+	// HistoryAnnotation keeps the last finished rollouts of a workload as a
+	// JSON list of RolloutRecord, oldest first.
+	HistoryAnnotation = "deployment-annotator.io/history"
 
 	DefaultMaxConcurrentReconciles = 2
 )
 
+// trackingAnnotations are all workload annotations owned by the controller.
+// CleanupAnnotations clears every one of them.
+var trackingAnnotations = []string{
+	StartAnnotation, EndAnnotation, VersionAnnotation, MilestonesAnnotation,
+	StartTimeAnnotation, TimedOutAnnotation, ChangeAnnotation, TriggerAnnotation,
+	PendingAnnotation, DeletingAnnotation, BurstAnnotation, ReleaseAnnotation,
+	HistoryAnnotation, WatchAnnotation, DipAnnotation,
+}
+
 // AnnotationClient is the seam between the reconciler and the annotation backend.
 // grafana.Client satisfies this interface; tests can supply a fake.
 type AnnotationClient interface {
-	CreateAnnotation(ctx context.Context, what string, tags []string, data string) (int64, error)
-	UpdateAnnotationToRegion(ctx context.Context, id int64, tags []string) error
+	CreateAnnotation(ctx context.Context, what string, tags []string, data string, when time.Time) (int64, error)
+	UpdateAnnotationToRegion(ctx context.Context, id int64, end time.Time, tags []string) error
+	// FindAnnotations returns the IDs of annotations carrying all of tags.
+	FindAnnotations(ctx context.Context, tags []string) ([]int64, error)
 }
 
 // WorkloadReconciler reconciles any workload type via its WorkloadAdapter.
@@ -39,6 +106,14 @@ type WorkloadReconciler struct {
 	Scheme    *runtime.Scheme
 	Adapter   WorkloadAdapter
 	Lifecycle *AnnotationLifecycle
+
+	// APIReader lists the pods of workloads without caching all pods of the
+	// cluster; nil uses the client.
+	APIReader client.Reader
+
+	// Deadline is the default rollout deadline for this kind; 0 disables it.
+	// Workloads can override it with DeadlineAnnotation.
+	Deadline time.Duration
 }
 
 func (r *WorkloadReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -59,9 +134,16 @@ func (r *WorkloadReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		logger.Error(err, "Failed to get namespace", "namespace", obj.GetNamespace())
 		return ctrl.Result{RequeueAfter: time.Minute}, nil
 	}
+	if obj.GetDeletionTimestamp() != nil {
+		return r.handleFinalizer(ctx, obj, kind, &ns)
+	}
 	if ns.Labels["deployment-annotator"] != "enabled" {
 		return ctrl.Result{}, nil
 	}
+	if err := r.Lifecycle.syncFinalizer(ctx, obj); err != nil {
+		logger.Error(err, "Failed to update deletion finalizer", "kind", kind)
+		return ctrl.Result{RequeueAfter: time.Minute}, err
+	}
 
 	logger.V(1).Info("Processing workload",
 		"kind", kind,
@@ -89,6 +171,18 @@ func (r *WorkloadReconciler) handleEvent(ctx context.Context, obj client.Object,
 
 	if storedVersion == "" {
 		logger.Info("Initializing tracking", "kind", kind, "name", name, "namespace", ns, "version", currentVersion)
+		rolling, err := r.backfill(ctx, obj, kind)
+		if err != nil {
+			return ctrl.Result{RequeueAfter: time.Minute}, err
+		}
+		if rolling {
+			// Open the rollout in progress, placed at its revision's creation.
+			change := r.describeChange(ctx, obj)
+			if err := r.Lifecycle.StartDeployment(ctx, obj, kind, currentVersion, imageRef, imageTag, change); err != nil {
+				return ctrl.Result{RequeueAfter: time.Minute}, err
+			}
+			return ctrl.Result{}, nil
+		}
 		if err := r.Lifecycle.InitializeTracking(ctx, obj, currentVersion); err != nil {
 			return ctrl.Result{RequeueAfter: time.Minute}, err
 		}
@@ -98,29 +192,134 @@ func (r *WorkloadReconciler) handleEvent(ctx context.Context, obj client.Object,
 	if storedVersion != currentVersion {
 		logger.Info("Version changed", "kind", kind, "name", name, "namespace", ns,
 			"oldVersion", storedVersion, "newVersion", currentVersion)
-		if err := r.Lifecycle.StartDeployment(ctx, obj, kind, currentVersion, imageRef, imageTag); err != nil {
+		change := r.describeChange(ctx, obj)
+		if r.Adapter.IsReady(obj) {
+			// The rollout already finished, e.g. while the controller was down.
+			_, completed := r.Adapter.RolloutTimes(obj)
+			caught, err := r.Lifecycle.CatchUpDeployment(ctx, obj, kind, currentVersion, imageRef, imageTag, change, completed)
+			if err != nil {
+				return ctrl.Result{RequeueAfter: time.Minute}, err
+			}
+			if caught {
+				return ctrl.Result{}, nil
+			}
+		}
+		if err := r.Lifecycle.StartDeployment(ctx, obj, kind, currentVersion, imageRef, imageTag, change); err != nil {
 			return ctrl.Result{RequeueAfter: time.Minute}, err
 		}
 		return ctrl.Result{}, nil
 	}
 
 	logger.V(1).Info("No version change", "kind", kind, "name", name, "namespace", ns, "version", currentVersion)
+	progress := r.Adapter.Progress(obj)
+	if err := r.Lifecycle.TrackAvailability(ctx, obj, kind, imageRef, imageTag, progress); err != nil {
+		return ctrl.Result{RequeueAfter: time.Minute}, err
+	}
+	if obj.GetAnnotations()[WatchAnnotation] != "" {
+		// The rollout completed. Pods crashing during the watch window make
+		// the workload unready, so the watch must not depend on readiness.
+		return r.watchStability(ctx, obj, kind, imageRef, imageTag)
+	}
 	if r.Adapter.IsReady(obj) {
-		if err := r.Lifecycle.CompleteDeployment(ctx, obj, kind, imageRef, imageTag); err != nil {
+		r.sampleRollout(ctx, obj, kind, true)
+		_, completed := r.Adapter.RolloutTimes(obj)
+		if err := r.Lifecycle.CompleteDeployment(ctx, obj, kind, imageRef, imageTag, completed); err != nil {
 			return ctrl.Result{RequeueAfter: time.Minute}, err
 		}
+		return r.watchStability(ctx, obj, kind, imageRef, imageTag)
 	}
-	return ctrl.Result{}, nil
+	r.sampleRollout(ctx, obj, kind, false)
+	if err := r.Lifecycle.RecordProgress(ctx, obj, kind, imageRef, imageTag, progress); err != nil {
+		return ctrl.Result{RequeueAfter: time.Minute}, err
+	}
+	deadline := stalledDeadline(obj, r.rolloutDeadline(ctx, obj))
+	var failures podFailures
+	if remaining, open := r.Lifecycle.untilDeadline(obj, deadline); open && remaining <= 0 {
+		failures = r.diagnosePods(ctx, obj)
+	}
+	remaining, err := r.Lifecycle.TimeoutDeployment(ctx, obj, kind, imageRef, imageTag, deadline, failures)
+	if err != nil {
+		return ctrl.Result{RequeueAfter: time.Minute}, err
+	}
+	// Wake up at the deadline even if the workload status stops changing.
+	return ctrl.Result{RequeueAfter: remaining}, nil
+}
+
+// stalledDeadline shortens deadline to the time the Deployment controller
+// gave up on the open rollout of obj (see progressStalledAt), so a stuck
+// rollout times out and is diagnosed even when no deadline is configured.
+func stalledDeadline(obj client.Object, deadline time.Duration) time.Duration {
+	stalledAt, ok := progressStalledAt(obj)
+	if !ok {
+		return deadline
+	}
+	startedAt, err := time.Parse(time.RFC3339, obj.GetAnnotations()[StartTimeAnnotation])
+	// A condition from before the rollout started belongs to an older one.
+	if err != nil || !stalledAt.After(startedAt) {
+		return deadline
+	}
+	if stalled := stalledAt.Sub(startedAt); deadline <= 0 || stalled < deadline {
+		return stalled
+	}
+	return deadline
+}
+
+// progressStalledAt returns when the Deployment controller reported the
+// rollout of obj as Progressing=False with reason ProgressDeadlineExceeded.
+// ok is false for other kinds and while the rollout is progressing.
+func progressStalledAt(obj client.Object) (time.Time, bool) {
+	d, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, c := range d.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Status == corev1.ConditionFalse &&
+			c.Reason == "ProgressDeadlineExceeded" {
+			return c.LastUpdateTime.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// rolloutDeadline returns the workload's DeadlineAnnotation override when it
+// is valid, otherwise the per-kind default.
+func (r *WorkloadReconciler) rolloutDeadline(ctx context.Context, obj client.Object) time.Duration {
+	v, ok := obj.GetAnnotations()[DeadlineAnnotation]
+	if !ok {
+		return r.Deadline
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return d
+	}
+	log.FromContext(ctx).Info("Ignoring invalid rollout deadline annotation",
+		"kind", r.Adapter.Kind(), "name", sanitizeForLog(obj.GetName()), "value", sanitizeForLog(v))
+	return r.Deadline
 }
 
 func (r *WorkloadReconciler) handleDeletion(ctx context.Context, req ctrl.Request, kind string) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
+	r.Lifecycle.releaseDeleted(ctx, kind, req.Namespace, req.Name, r.Lifecycle.now())
+	// Consumed first, so the entry is dropped whatever the namespace state.
+	if r.Lifecycle.finalizedDeletion(kind, req.NamespacedName) {
+		return ctrl.Result{}, nil
+	}
 
 	var ns corev1.Namespace
 	if err := r.Get(ctx, client.ObjectKey{Name: req.Namespace}, &ns); err != nil {
+		if apierrors.IsNotFound(err) {
+			// The namespace is gone; its deletion annotation covers the workload.
+			return ctrl.Result{}, nil
+		}
 		logger.Error(err, "Failed to get namespace for deletion check")
 		return ctrl.Result{}, nil
 	}
+	if namespaceTerminating(&ns) {
+		// The namespace is annotated as a whole (see AnnounceTracking).
+		return ctrl.Result{}, nil
+	}
 	if ns.Labels["deployment-annotator"] != "enabled" {
 		logger.V(1).Info("Ignoring deletion in unlabeled namespace", "kind", kind, "name", req.Name)
 		return ctrl.Result{}, nil
@@ -139,6 +338,10 @@ func (r *WorkloadReconciler) mapNamespaceToWorkloads(ctx context.Context, obj cl
 		return nil
 	}
 
+	if ns.DeletionTimestamp != nil {
+		return nil
+	}
+
 	enabled := ns.Labels["deployment-annotator"] == "enabled"
 	list := r.Adapter.NewObjectList()
 	if err := r.List(ctx, list, client.InNamespace(ns.Name)); err != nil {
@@ -3,8 +3,11 @@ package controller
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -24,26 +27,47 @@ type annotationCall struct {
 	tags   []string
 	data   string
 	id     int64
+	at     time.Time // when for creates, the region end for region updates
 }
 
 type fakeAnnotationClient struct {
-	calls  []annotationCall
-	nextID int64
+	calls     []annotationCall
+	nextID    int64
+	createErr error // returned by CreateAnnotation when set
+	regionErr error // returned by UpdateAnnotationToRegion when set
 }
 
 func (f *fakeAnnotationClient) CreateAnnotation(
-	_ context.Context, what string, tags []string, data string,
+	_ context.Context, what string, tags []string, data string, when time.Time,
 ) (int64, error) {
+	if f.createErr != nil {
+		return 0, f.createErr
+	}
 	f.nextID++
-	f.calls = append(f.calls, annotationCall{method: "create", what: what, tags: tags, data: data, id: f.nextID})
+	f.calls = append(f.calls, annotationCall{
+		method: "create", what: what, tags: tags, data: data, id: f.nextID, at: when,
+	})
 	return f.nextID, nil
 }
 
-func (f *fakeAnnotationClient) UpdateAnnotationToRegion(_ context.Context, id int64, tags []string) error {
-	f.calls = append(f.calls, annotationCall{method: "region", id: id, tags: tags})
+func (f *fakeAnnotationClient) UpdateAnnotationToRegion(_ context.Context, id int64, end time.Time, tags []string) error {
+	if f.regionErr != nil {
+		return f.regionErr
+	}
+	f.calls = append(f.calls, annotationCall{method: "region", id: id, tags: tags, at: end})
 	return nil
 }
 
+func (f *fakeAnnotationClient) FindAnnotations(_ context.Context, tags []string) ([]int64, error) {
+	var ids []int64
+	for _, c := range f.createCalls() {
+		if !slices.ContainsFunc(tags, func(t string) bool { return !slices.Contains(c.tags, t) }) {
+			ids = append(ids, c.id)
+		}
+	}
+	return ids, nil
+}
+
 func (f *fakeAnnotationClient) createCalls() []annotationCall {
 	var out []annotationCall
 	for _, c := range f.calls {
@@ -121,6 +145,10 @@ func newReconciler(objs []client.Object, gc *fakeAnnotationClient) (*WorkloadRec
 		WithScheme(scheme).
 		WithObjects(objs...).
 		WithStatusSubresource(&appsv1.Deployment{}).
+		// The API server supports this field selector for events.
+		WithIndex(&corev1.Event{}, "involvedObject.kind", func(o client.Object) []string {
+			return []string{o.(*corev1.Event).InvolvedObject.Kind}
+		}).
 		Build()
 	lc := &AnnotationLifecycle{Client: c, GClient: gc}
 	r := &WorkloadReconciler{
@@ -403,3 +431,623 @@ func TestReconcile_FullLifecycle(t *testing.T) {
 		t.Fatalf("region should reference start ID %d, got %d", sid, regions[0].id)
 	}
 }
+
+func TestReconcile_InProgress_RecordsMilestonesOnce(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	d := deployment("app", "ns", "nginx:1.21", 1)
+	d.Spec.Replicas = ptrInt32(2)
+	d.Status = appsv1.DeploymentStatus{
+		Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 3, ObservedGeneration: 1,
+	}
+	d.Annotations = map[string]string{
+		VersionAnnotation: "gen-1-img-1.21",
+		StartAnnotation:   "100",
+	}
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+	r.Lifecycle.Milestones = true
+
+	for range 2 {
+		if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	creates := gc.createCalls()
+	if len(creates) != 2 {
+		t.Fatalf("expected 2 milestone annotations, got %d", len(creates))
+	}
+	for i, want := range []string{"first-ready", "half-updated"} {
+		if creates[i].what != "deploy-milestone:app" || !slices.Contains(creates[i].tags, want) {
+			t.Fatalf("create %d: expected milestone %s, got %s %v", i, want, creates[i].what, creates[i].tags)
+		}
+	}
+	got := getDeployment(t, c, "app", "ns")
+	if v := got.Annotations[MilestonesAnnotation]; v != "first-ready,half-updated" {
+		t.Fatalf("expected milestones to be stored, got %q", v)
+	}
+}
+
+func TestReconcile_InProgress_MilestonesDisabledByDefault(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	d := deployment("app", "ns", "nginx:1.21", 1)
+	d.Status = appsv1.DeploymentStatus{
+		Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 0, ObservedGeneration: 1,
+	}
+	d.Annotations = map[string]string{
+		VersionAnnotation: "gen-1-img-1.21",
+		StartAnnotation:   "100",
+	}
+	r, _ := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	if len(gc.calls) != 0 {
+		t.Fatalf("expected no Grafana calls, got %d", len(gc.calls))
+	}
+}
+
+func ptrInt32(v int32) *int32 { return &v }
+
+func TestReconcile_DeadlineExceeded_TimesOutThenCompletesLate(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := deployment("app", "ns", "nginx:1.21", 1)
+	d.Annotations = map[string]string{
+		VersionAnnotation:   "gen-1-img-1.21",
+		StartAnnotation:     "100",
+		StartTimeAnnotation: now.Add(-20 * time.Minute).Format(time.RFC3339),
+	}
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+	r.Deadline = 10 * time.Minute
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	creates := gc.createCalls()
+	if len(creates) != 1 || creates[0].what != "deploy-timeout:app" {
+		t.Fatalf("expected a timed-out annotation, got %+v", creates)
+	}
+	regions := gc.regionCalls()
+	if len(regions) != 1 || regions[0].id != 100 || !slices.Contains(regions[0].tags, "timed-out") {
+		t.Fatalf("expected start 100 closed as timed-out region, got %+v", regions)
+	}
+	got := getDeployment(t, c, "app", "ns")
+	if got.Annotations[TimedOutAnnotation] == "" || got.Annotations[EndAnnotation] == "" {
+		t.Fatalf("expected timed-out state to be stored, got %v", got.Annotations)
+	}
+
+	// The rollout finishes after its deadline.
+	got.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1, ObservedGeneration: 1}
+	if err := c.Status().Update(context.Background(), got); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	creates = gc.createCalls()
+	if len(creates) != 2 || creates[1].what != "deploy-end:app" || !slices.Contains(creates[1].tags, "late") {
+		t.Fatalf("expected one late completion annotation, got %+v", creates)
+	}
+	if len(gc.regionCalls()) != 1 {
+		t.Fatal("late completion must not re-close the region")
+	}
+	got = getDeployment(t, c, "app", "ns")
+	if got.Annotations[TimedOutAnnotation] != "" {
+		t.Fatal("expected timed-out marker to be cleared")
+	}
+}
+
+func TestReconcile_DeadlineNotReached_Requeues(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := deployment("app", "ns", "nginx:1.21", 1)
+	d.Annotations = map[string]string{
+		VersionAnnotation:   "gen-1-img-1.21",
+		StartAnnotation:     "100",
+		StartTimeAnnotation: now.Add(-5 * time.Minute).Format(time.RFC3339),
+		DeadlineAnnotation:  "900",
+	}
+	r, _ := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+
+	res, err := r.Reconcile(context.Background(), reconcileReq("app", "ns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RequeueAfter != 10*time.Minute {
+		t.Fatalf("expected requeue at the annotated deadline, got %s", res.RequeueAfter)
+	}
+	if len(gc.calls) != 0 {
+		t.Fatalf("expected no Grafana calls before the deadline, got %d", len(gc.calls))
+	}
+}
+
+func TestReconcile_VersionChange_TagsChangeCategories(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	d := deployment("app", "ns", "nginx:1.22", 2)
+	d.UID = "app-uid"
+	d.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.21"}
+	oldRS := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "app-old", Namespace: "ns",
+			Labels:      map[string]string{"app": "app", "pod-template-hash": "old"},
+			Annotations: map[string]string{"deployment.kubernetes.io/revision": "1"},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "Deployment", Name: "app", UID: "app-uid",
+				Controller: ptrBool(true),
+			}},
+		},
+		Spec: appsv1.ReplicaSetSpec{Template: *deployment("app", "ns", "nginx:1.21", 1).Spec.Template.DeepCopy()},
+	}
+	oldRS.Spec.Template.Labels["pod-template-hash"] = "old"
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d, oldRS}, gc)
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	creates := gc.createCalls()
+	if len(creates) != 1 || !slices.Contains(creates[0].tags, "change:image") {
+		t.Fatalf("expected start annotation tagged change:image, got %+v", creates)
+	}
+	if want := "Started deployment nginx:1.22 — main: image nginx:1.21 → nginx:1.22"; creates[0].data != want {
+		t.Fatalf("expected change summary in text, got %q", creates[0].data)
+	}
+	got := getDeployment(t, c, "app", "ns")
+	if got.Annotations[ChangeAnnotation] != "image" {
+		t.Fatalf("expected change categories to be stored, got %q", got.Annotations[ChangeAnnotation])
+	}
+}
+
+func ptrBool(v bool) *bool { return &v }
+
+func TestReconcile_StructuredTags_StartAndRegion(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	d := deployment("api", "api", "nginx:1.21", 1)
+	d.Annotations = map[string]string{VersionAnnotation: "gen-0-img-old"}
+	r, c := newReconciler([]client.Object{trackedNamespace("api"), d}, gc)
+	r.Lifecycle.TagSchema = TagSchemaStructured
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("api", "api")); err != nil {
+		t.Fatal(err)
+	}
+	got := getDeployment(t, c, "api", "api")
+	got.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1, ObservedGeneration: 1}
+	if err := c.Status().Update(context.Background(), got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(context.Background(), reconcileReq("api", "api")); err != nil {
+		t.Fatal(err)
+	}
+
+	start := slices.DeleteFunc(slices.Clone(gc.createCalls()[0].tags), func(tag string) bool {
+		return strings.HasPrefix(tag, "idempotency-key:")
+	})
+	want := []string{"deploy", "namespace:api", "workload:api", "kind:deployment", "image-tag:1.21", "event:started"}
+	if !slices.Equal(start, want) {
+		t.Fatalf("start tags: got %v, want %v", start, want)
+	}
+	regions := gc.regionCalls()
+	if len(regions) != 1 || !slices.Contains(regions[0].tags, "event:region") ||
+		!slices.Contains(regions[0].tags, "workload:api") {
+		t.Fatalf("expected structured region tags, got %+v", regions)
+	}
+}
+
+func TestReconcile_MetadataTags_FromWorkloadAndNamespace(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	ns := trackedNamespace("ns")
+	ns.Labels["team"] = "platform"
+	ns.Labels["tier"] = "backend"
+	d := readyDeployment("app", "ns", "nginx:1.21", 1)
+	d.Labels = map[string]string{"team": "payments"}
+	d.Annotations = map[string]string{
+		VersionAnnotation: "gen-1-img-1.21",
+		StartAnnotation:   "100",
+	}
+	r, _ := newReconciler([]client.Object{ns, d}, gc)
+	r.Lifecycle.TagLabelKeys = []string{"team", "tier", "app.kubernetes.io/part-of"}
+	r.Lifecycle.TagNamespaceMetadata = true
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	for _, call := range gc.calls {
+		if !slices.Contains(call.tags, "team:payments") || !slices.Contains(call.tags, "tier:backend") {
+			t.Fatalf("%s call missing metadata tags: %v", call.method, call.tags)
+		}
+		if slices.Contains(call.tags, "team:platform") {
+			t.Fatalf("workload label should win over namespace label: %v", call.tags)
+		}
+	}
+	if len(gc.calls) != 2 {
+		t.Fatalf("expected end + region calls, got %d", len(gc.calls))
+	}
+}
+
+func TestReconcile_VersionChange_RecordsProvenance(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	d := deployment("app", "ns", "nginx:1.22", 2)
+	d.Annotations = map[string]string{
+		VersionAnnotation:     "gen-1-img-1.21",
+		helmReleaseAnnotation: "shop",
+		changeCauseAnnotation: "bump nginx",
+	}
+	d.Labels = map[string]string{helmChartLabel: "shop-1.4.0"}
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	creates := gc.createCalls()
+	if len(creates) != 1 || !slices.Contains(creates[0].tags, "trigger:helm") {
+		t.Fatalf("expected start annotation tagged trigger:helm, got %+v", creates)
+	}
+	if !strings.Contains(creates[0].data, "triggered by helm (shop@shop-1.4.0); change-cause: bump nginx") {
+		t.Fatalf("expected provenance in text, got %q", creates[0].data)
+	}
+	if stored := getDeployment(t, c, "app", "ns").Annotations[TriggerAnnotation]; stored != "trigger:helm" {
+		t.Fatalf("expected trigger tags to be stored, got %q", stored)
+	}
+}
+
+func TestReconcile_Completion_AnnotationStyles(t *testing.T) {
+	tests := []struct {
+		style            AnnotationStyle
+		creates, regions int
+		wantEnd          string
+	}{
+		{AnnotationStyleThreePhase, 1, 1, "1"},
+		{AnnotationStyleRegion, 0, 1, "100"},
+		{AnnotationStylePoints, 1, 0, "1"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.style), func(t *testing.T) {
+			gc := &fakeAnnotationClient{}
+			d := readyDeployment("app", "ns", "nginx:1.22", 1)
+			d.Annotations = map[string]string{
+				VersionAnnotation: "gen-1-img-1.22",
+				StartAnnotation:   "100",
+			}
+			r, c := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+			r.Lifecycle.Style = tt.style
+
+			// The second reconcile must be a no-op in every style.
+			for range 2 {
+				if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := len(gc.createCalls()); got != tt.creates {
+				t.Errorf("expected %d end annotations, got %d", tt.creates, got)
+			}
+			regions := gc.regionCalls()
+			if len(regions) != tt.regions || (len(regions) == 1 && regions[0].id != 100) {
+				t.Errorf("expected %d region updates of annotation 100, got %+v", tt.regions, regions)
+			}
+			if got := getDeployment(t, c, "app", "ns").Annotations[EndAnnotation]; got != tt.wantEnd {
+				t.Errorf("expected end annotation id %q, got %q", tt.wantEnd, got)
+			}
+		})
+	}
+}
+
+func TestReconcile_RegionStyle_TimeoutThenLateCompletionExtendsRegion(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := deployment("app", "ns", "nginx:1.21", 1)
+	d.Annotations = map[string]string{
+		VersionAnnotation:   "gen-1-img-1.21",
+		StartAnnotation:     "100",
+		StartTimeAnnotation: now.Add(-20 * time.Minute).Format(time.RFC3339),
+	}
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+	r.Lifecycle.Style = AnnotationStyleRegion
+	r.Deadline = 10 * time.Minute
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	got := getDeployment(t, c, "app", "ns")
+	got.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1, ObservedGeneration: 1}
+	if err := c.Status().Update(context.Background(), got); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(gc.createCalls()) != 0 {
+		t.Fatalf("region style must not create point annotations, got %+v", gc.createCalls())
+	}
+	regions := gc.regionCalls()
+	if len(regions) != 2 || !slices.Contains(regions[0].tags, "timed-out") || !slices.Contains(regions[1].tags, "late") {
+		t.Fatalf("expected a timed-out region extended by a late completion, got %+v", regions)
+	}
+}
+
+func controlledReplicaSet(d *appsv1.Deployment, name, revision string, created time.Time) *appsv1.ReplicaSet {
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: d.Namespace,
+			CreationTimestamp: metav1.NewTime(created),
+			Labels:            map[string]string{"app": d.Name, "pod-template-hash": name},
+			Annotations:       map[string]string{"deployment.kubernetes.io/revision": revision},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "Deployment", Name: d.Name, UID: d.UID,
+				Controller: ptrBool(true),
+			}},
+		},
+		Spec: appsv1.ReplicaSetSpec{Template: *d.Spec.Template.DeepCopy()},
+	}
+	rs.Spec.Template.Labels["pod-template-hash"] = name
+	return rs
+}
+
+func TestReconcile_UsesKubernetesEventTimes(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := deployment("app", "ns", "nginx:1.22", 2)
+	d.UID = "app-uid"
+	d.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.21"}
+	rs := controlledReplicaSet(d, "app-new", "2", now.Add(-3*time.Minute))
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d, rs}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	got := getDeployment(t, c, "app", "ns")
+	if start := gc.createCalls()[0].at; !start.Equal(now.Add(-3 * time.Minute)) {
+		t.Fatalf("expected start at ReplicaSet creation, got %s", start)
+	}
+
+	completed := now.Add(-time.Minute)
+	got.Status = appsv1.DeploymentStatus{
+		UpdatedReplicas: 1, AvailableReplicas: 1, ObservedGeneration: 2,
+		Conditions: []appsv1.DeploymentCondition{{
+			Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue,
+			Reason: "NewReplicaSetAvailable", LastUpdateTime: metav1.NewTime(completed),
+		}},
+	}
+	if err := c.Status().Update(context.Background(), got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	creates, regions := gc.createCalls(), gc.regionCalls()
+	if len(creates) != 2 || !creates[1].at.Equal(completed) {
+		t.Fatalf("expected end annotation at the Progressing condition update, got %+v", creates)
+	}
+	if len(regions) != 1 || !regions[0].at.Equal(completed) {
+		t.Fatalf("expected region to end at the Progressing condition update, got %+v", regions)
+	}
+}
+
+func TestReconcile_RollbackToReusedRevision_StartsNow(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := deployment("app", "ns", "nginx:1.21", 3)
+	d.UID = "app-uid"
+	d.Annotations = map[string]string{
+		VersionAnnotation:   "gen-2-img-1.22",
+		StartTimeAnnotation: now.Add(-10 * time.Minute).Format(time.RFC3339),
+	}
+	// The rollback reuses the ReplicaSet of an older revision.
+	rs := controlledReplicaSet(d, "app-old", "3", now.Add(-24*time.Hour))
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d, rs}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	if start := gc.createCalls()[0].at; !start.Equal(now) {
+		t.Fatalf("expected start at the current time, got %s", start)
+	}
+	if got := getDeployment(t, c, "app", "ns").Annotations[StartTimeAnnotation]; got != now.Format(time.RFC3339) {
+		t.Fatalf("expected start time %s to be stored, got %s", now.Format(time.RFC3339), got)
+	}
+}
+
+func TestReconcile_MissedRollout_IsReconstructed(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	started, completed := now.Add(-2*time.Hour), now.Add(-110*time.Minute)
+	d := readyDeployment("app", "ns", "nginx:1.22", 2)
+	d.UID = "app-uid"
+	d.Annotations = map[string]string{
+		VersionAnnotation:   "gen-1-img-1.21",
+		StartAnnotation:     "7",
+		EndAnnotation:       "8",
+		StartTimeAnnotation: now.Add(-24 * time.Hour).Format(time.RFC3339),
+	}
+	d.Status.Conditions = []appsv1.DeploymentCondition{{
+		Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue,
+		Reason: "NewReplicaSetAvailable", LastUpdateTime: metav1.NewTime(completed),
+	}}
+	rs := controlledReplicaSet(d, "app-new", "2", started)
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d, rs}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+
+	for range 2 {
+		if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	creates, regions := gc.createCalls(), gc.regionCalls()
+	if len(creates) != 2 || !creates[0].at.Equal(started) || !creates[1].at.Equal(completed) {
+		t.Fatalf("expected start and end annotations at the rollout's own times, got %+v", creates)
+	}
+	if len(regions) != 1 || regions[0].id != creates[0].id || !regions[0].at.Equal(completed) {
+		t.Fatalf("expected the start annotation closed at completion, got %+v", regions)
+	}
+	for _, call := range gc.calls {
+		if !slices.Contains(call.tags, "reconstructed") {
+			t.Fatalf("%s call not tagged reconstructed: %v", call.method, call.tags)
+		}
+	}
+	got := getDeployment(t, c, "app", "ns")
+	if got.Annotations[EndAnnotation] != strconv.FormatInt(creates[1].id, 10) {
+		t.Fatalf("expected the reconstructed rollout to be completed, got %v", got.Annotations)
+	}
+}
+
+func TestReconcile_ReadyWithoutHistory_StartsNormally(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	d := readyDeployment("app", "ns", "nginx:1.22", 2)
+	d.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.21"}
+	r, _ := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	creates := gc.createCalls()
+	if len(creates) != 1 || creates[0].what != "deploy-start:app" || slices.Contains(creates[0].tags, "reconstructed") {
+		t.Fatalf("expected a regular start annotation, got %+v", creates)
+	}
+}
+
+func TestReconcile_FirstTracking_BackfillsHistoryOnce(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := readyDeployment("app", "ns", "nginx:1.23", 3)
+	d.UID = "app-uid"
+	completed := now.Add(-50 * time.Minute)
+	d.Status.Conditions = []appsv1.DeploymentCondition{{
+		Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue,
+		Reason: "NewReplicaSetAvailable", LastUpdateTime: metav1.NewTime(completed),
+	}}
+	var objs []client.Object
+	for i, image := range []string{"nginx:1.21", "nginx:1.22", "nginx:1.23"} {
+		rev := deployment("app", "ns", image, int64(i+1))
+		rev.UID = d.UID
+		objs = append(objs, controlledReplicaSet(rev, fmt.Sprintf("app-%d", i+1), strconv.Itoa(i+1),
+			now.Add(-time.Duration(3-i)*time.Hour)))
+	}
+	r, c := newReconciler(append(objs, trackedNamespace("ns"), d), gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+	r.Lifecycle.Backfill = 2
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	creates, regions := gc.createCalls(), gc.regionCalls()
+	if len(creates) != 2 || creates[0].data != "Deployed nginx:1.22 (revision 2, backfilled)" ||
+		!creates[1].at.Equal(now.Add(-time.Hour)) || !slices.Contains(creates[1].tags, "backfill") {
+		t.Fatalf("expected the last two revisions to be backfilled oldest first, got %+v", creates)
+	}
+	if len(regions) != 2 || regions[0].id != creates[0].id || !regions[0].at.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("expected the older revision to end where the next one started, got %+v", regions)
+	}
+	if regions[1].id != creates[1].id || !regions[1].at.Equal(completed) {
+		t.Fatalf("expected the current revision to become a region ending at completion, got %+v", regions)
+	}
+
+	// Untracking and tracking again must not duplicate the backfill.
+	got := getDeployment(t, c, "app", "ns")
+	if err := r.Lifecycle.CleanupAnnotations(context.Background(), got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	if len(gc.createCalls()) != 2 {
+		t.Fatalf("expected no duplicate backfill annotations, got %+v", gc.createCalls())
+	}
+}
+
+func TestReconcile_FirstTracking_BackfillKeySurvivesTagsTemplate(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := readyDeployment("app", "ns", "nginx:1.23", 2)
+	d.UID = "app-uid"
+	var objs []client.Object
+	for i, image := range []string{"nginx:1.22", "nginx:1.23"} {
+		rev := deployment("app", "ns", image, int64(i+1))
+		rev.UID = d.UID
+		objs = append(objs, controlledReplicaSet(rev, fmt.Sprintf("app-%d", i+1), strconv.Itoa(i+1),
+			now.Add(-time.Duration(2-i)*time.Hour)))
+	}
+	r, c := newReconciler(append(objs, trackedNamespace("ns"), d), gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+	r.Lifecycle.Backfill = 2
+	tmpl, err := ParseAnnotationTemplates(`{"backfill": {"tags": "history,{{.Name}}"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Lifecycle.Templates = tmpl
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	creates := gc.createCalls()
+	if len(creates) != 2 || !slices.Contains(creates[0].tags, "history") ||
+		!slices.Contains(creates[0].tags, "backfill:deployment/ns/app-1") {
+		t.Fatalf("expected templated tags plus the backfill key, got %+v", creates)
+	}
+
+	got := getDeployment(t, c, "app", "ns")
+	if err := r.Lifecycle.CleanupAnnotations(context.Background(), got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	if len(gc.createCalls()) != 2 {
+		t.Fatalf("expected no duplicate backfill annotations, got %+v", gc.createCalls())
+	}
+}
+
+func TestReconcile_FirstTracking_OpensRolloutInProgress(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := deployment("app", "ns", "nginx:1.23", 2)
+	d.UID = "app-uid"
+	var objs []client.Object
+	for i, image := range []string{"nginx:1.22", "nginx:1.23"} {
+		rev := deployment("app", "ns", image, int64(i+1))
+		rev.UID = d.UID
+		objs = append(objs, controlledReplicaSet(rev, fmt.Sprintf("app-%d", i+1), strconv.Itoa(i+1),
+			now.Add(-time.Duration(2-i)*time.Hour)))
+	}
+	r, c := newReconciler(append(objs, trackedNamespace("ns"), d), gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+	r.Lifecycle.Backfill = 2
+
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	creates, regions := gc.createCalls(), gc.regionCalls()
+	if len(creates) != 2 || creates[0].data != "Deployed nginx:1.22 (revision 1, backfilled)" {
+		t.Fatalf("expected the previous revision to be backfilled, got %+v", creates)
+	}
+	if len(regions) != 1 || regions[0].id != creates[0].id || !regions[0].at.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("expected the previous revision to end where the rollout started, got %+v", regions)
+	}
+	if creates[1].what != "deploy-start:app" || !creates[1].at.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("expected the rollout in progress to start at its revision, got %+v", creates[1])
+	}
+	got := getDeployment(t, c, "app", "ns")
+	if got.Annotations[StartAnnotation] != strconv.FormatInt(creates[1].id, 10) {
+		t.Fatalf("expected the rollout to be open, got %v", got.Annotations)
+	}
+
+	// Its completion is annotated like any other.
+	got.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1, ObservedGeneration: 2}
+	if err := c.Status().Update(context.Background(), got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(context.Background(), reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	if creates := gc.createCalls(); len(creates) != 3 || creates[2].what != "deploy-end:app" {
+		t.Fatalf("expected an end annotation, got %+v", creates)
+	}
+}
@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// releaseRegions tracks the components of each open release region in
+// memory, so components starting or finishing at the same time agree on the
+// region even before their workload annotations reach the cache. mu only
+// guards the map and the regions' fields; it is never held across requests.
+type releaseRegions struct {
+	mu      sync.Mutex
+	regions map[string]*releaseRegion // by namespace/release
+}
+
+// releaseRegion is one open release region.
+type releaseRegion struct {
+	// opening serializes the components of one release looking up or
+	// creating the region, so only one annotation is created.
+	opening sync.Mutex
+	id      string
+	chart   string
+	members map[string]bool // component keys kind/name
+}
+
+// region returns the state of release key, creating it when missing.
+func (r *releaseRegions) region(key string) *releaseRegion {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.regions == nil {
+		r.regions = map[string]*releaseRegion{}
+	}
+	reg := r.regions[key]
+	if reg == nil {
+		reg = &releaseRegion{members: map[string]bool{}}
+		r.regions[key] = reg
+	}
+	return reg
+}
+
+// regionID returns the ID of the open region of reg, or "".
+func (r *releaseRegions) regionID(reg *releaseRegion) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return reg.id
+}
+
+// join records component as rolling in the region id of release key.
+func (r *releaseRegions) join(key, component, id, chart string) {
+	reg := r.region(key)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reg.id, reg.chart = id, chart
+	reg.members[component] = true
+}
+
+// leave removes component from release key and reports whether other
+// components are still rolling in it.
+func (r *releaseRegions) leave(key, component string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reg := r.regions[key]
+	if reg == nil {
+		return false
+	}
+	delete(reg.members, component)
+	return len(reg.members) > 0
+}
+
+// forget drops release key when no component joined it in the meantime, and
+// reports whether it did.
+func (r *releaseRegions) forget(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if reg := r.regions[key]; reg != nil && len(reg.members) > 0 {
+		return false
+	}
+	delete(r.regions, key)
+	return true
+}
+
+// helmRelease returns the Helm release obj belongs to, or "".
+func helmRelease(obj client.Object) string {
+	if v := obj.GetAnnotations()[helmReleaseAnnotation]; v != "" {
+		return v
+	}
+	return obj.GetLabels()[instanceLabel]
+}
+
+// openRelease adds a starting component to the region of its Helm release,
+// creating the region annotation at startedAt when no other component of the
+// release is rolling. The region ID is stored in ReleaseAnnotation.
+func (l *AnnotationLifecycle) openRelease(ctx context.Context, obj client.Object, kind string, startedAt time.Time) {
+	release := helmRelease(obj)
+	if !l.ReleaseRegions || release == "" {
+		return
+	}
+	logger := log.FromContext(ctx)
+	key := obj.GetNamespace() + "/" + release
+	chart := obj.GetLabels()[helmChartLabel]
+
+	reg := l.releases.region(key)
+	reg.opening.Lock()
+	defer reg.opening.Unlock()
+	id := obj.GetAnnotations()[ReleaseAnnotation]
+	if id == "" {
+		id = l.releases.regionID(reg)
+	}
+	if id == "" {
+		// Components that started before a restart are only known from
+		// their workload annotations.
+		id = l.openReleaseID(ctx, obj, kind, release)
+	}
+	if id == "" {
+		text := fmt.Sprintf("Helm release %s", release)
+		var tags []string
+		if chart != "" {
+			text += fmt.Sprintf(" (chart %s)", chart)
+			tags = append(tags, "chart:"+sanitizeForLog(chart))
+		}
+		created, err := l.createOnce(ctx, obj, annotationEvent{
+			obj: obj, kind: "release", name: release, namespace: obj.GetNamespace(),
+			eventType: "release", at: startedAt, text: text, tags: tags,
+		})
+		if err != nil {
+			logger.Error(err, "Failed to create release annotation", "release", sanitizeForLog(release))
+			return
+		}
+		id = strconv.FormatInt(created, 10)
+		logger.Info("Opened release region", "release", sanitizeForLog(release), "annotationID", id)
+	}
+	if err := l.patchAnnotations(ctx, obj, map[string]string{ReleaseAnnotation: id, PendingAnnotation: ""}); err != nil {
+		logger.Error(err, "Failed to store release annotation", "release", sanitizeForLog(release))
+		return
+	}
+	l.releases.join(key, kind+"/"+obj.GetName(), id, chart)
+}
+
+// openReleaseID returns the release region another component of the release
+// is still rolling in, or "".
+func (l *AnnotationLifecycle) openReleaseID(ctx context.Context, obj client.Object, kind, release string) string {
+	for _, sibling := range l.releaseComponents(ctx, obj, kind, release) {
+		if id := sibling.GetAnnotations()[ReleaseAnnotation]; id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// closeRelease removes a finished component from its release region and
+// turns the region annotation into a region ending at end when it was the
+// last component rolling.
+func (l *AnnotationLifecycle) closeRelease(ctx context.Context, obj client.Object, kind string, end time.Time) {
+	id := obj.GetAnnotations()[ReleaseAnnotation]
+	if id == "" {
+		return
+	}
+	release := helmRelease(obj)
+	key := obj.GetNamespace() + "/" + release
+	if err := l.patchAnnotations(ctx, obj, map[string]string{ReleaseAnnotation: ""}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to clear release annotation", "release", sanitizeForLog(release))
+		return
+	}
+	if l.releases.leave(key, kind+"/"+obj.GetName()) {
+		return
+	}
+	for _, sibling := range l.releaseComponents(ctx, obj, kind, release) {
+		if sibling.GetAnnotations()[ReleaseAnnotation] == id {
+			return
+		}
+	}
+	if l.releases.forget(key) {
+		l.endReleaseRegion(ctx, obj.GetNamespace(), release, obj.GetLabels()[helmChartLabel], id, end)
+	}
+}
+
+// releaseDeleted removes a deleted workload from the release regions of its
+// namespace, closing at end the regions it was the last component of.
+// Components are only known in memory here: after a restart, the region of
+// a deleted component closes with the last of its remaining components.
+func (l *AnnotationLifecycle) releaseDeleted(ctx context.Context, kind, namespace, name string, end time.Time) {
+	component := kind + "/" + name
+	type closing struct{ key, id, chart string }
+	var closed []closing
+	l.releases.mu.Lock()
+	for key, reg := range l.releases.regions {
+		if !strings.HasPrefix(key, namespace+"/") || !reg.members[component] {
+			continue
+		}
+		delete(reg.members, component)
+		if len(reg.members) == 0 {
+			delete(l.releases.regions, key)
+			closed = append(closed, closing{key, reg.id, reg.chart})
+		}
+	}
+	l.releases.mu.Unlock()
+	for _, c := range closed {
+		l.endReleaseRegion(ctx, namespace, strings.TrimPrefix(c.key, namespace+"/"), c.chart, c.id, end)
+	}
+}
+
+// endReleaseRegion turns release annotation id into a region ending at end.
+func (l *AnnotationLifecycle) endReleaseRegion(ctx context.Context, namespace, release, chart, id string, end time.Time) {
+	logger := log.FromContext(ctx)
+	sid, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return
+	}
+	tags := l.baseTags("release", namespace, release, "", "release")
+	if chart != "" {
+		tags = append(tags, "chart:"+sanitizeForLog(chart))
+	}
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	if err := l.GClient.UpdateAnnotationToRegion(ctx, sid, end, tags); err != nil {
+		logger.Error(err, "Failed to close release region", "release", sanitizeForLog(release), "annotationID", sid)
+		return
+	}
+	logger.Info("Closed release region", "release", sanitizeForLog(release), "annotationID", sid)
+}
+
+// releaseComponents lists the other workloads of the same Helm release in
+// obj's namespace, across all watched kinds, leaving out those being deleted.
+func (l *AnnotationLifecycle) releaseComponents(
+	ctx context.Context, obj client.Object, kind, release string,
+) []client.Object {
+	adapters := l.Adapters
+	if len(adapters) == 0 {
+		adapters = []WorkloadAdapter{adapterFor(kind)}
+	}
+	var out []client.Object
+	for _, a := range adapters {
+		if a == nil {
+			continue
+		}
+		list := a.NewObjectList()
+		if err := l.Client.List(ctx, list, client.InNamespace(obj.GetNamespace())); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list release components", "kind", a.Kind())
+			continue
+		}
+		for _, item := range a.ExtractItems(list) {
+			// Workloads being deleted no longer hold the region open.
+			if item.GetDeletionTimestamp() != nil {
+				continue
+			}
+			if helmRelease(item) == release && (a.Kind() != kind || item.GetName() != obj.GetName()) {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+// adapterFor returns the adapter of a workload kind, or nil.
+func adapterFor(kind string) WorkloadAdapter {
+	for _, a := range []WorkloadAdapter{DeploymentAdapter{}, StatefulSetAdapter{}, DaemonSetAdapter{}} {
+		if a.Kind() == kind {
+			return a
+		}
+	}
+	return nil
+}
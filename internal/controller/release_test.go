@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcile_ReleaseRegion_SpansAllComponents(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	objs := []client.Object{trackedNamespace("ns")}
+	for _, name := range []string{"api", "worker"} {
+		d := deployment(name, "ns", "shop:2.0", 2)
+		d.Labels = map[string]string{helmChartLabel: "shop-1.4.0"}
+		d.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.0", helmReleaseAnnotation: "shop"}
+		objs = append(objs, d)
+	}
+	other := deployment("other", "ns", "other:2.0", 2)
+	other.Labels = map[string]string{instanceLabel: "other"}
+	other.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.0"}
+	objs = append(objs, other)
+	r, c := newReconciler(objs, gc)
+	r.Lifecycle.ReleaseRegions = true
+	ctx := context.Background()
+
+	for _, name := range []string{"api", "worker"} {
+		if _, err := r.Reconcile(ctx, reconcileReq(name, "ns")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var releases []annotationCall
+	for _, call := range gc.createCalls() {
+		if slices.Contains(call.tags, "release") {
+			releases = append(releases, call)
+		}
+	}
+	if len(releases) != 1 || releases[0].data != "Helm release shop (chart shop-1.4.0)" ||
+		!slices.Contains(releases[0].tags, "chart:shop-1.4.0") {
+		t.Fatalf("expected one release annotation for both components, got %+v", releases)
+	}
+	releaseID := releases[0].id
+
+	complete := func(name string) {
+		t.Helper()
+		got := getDeployment(t, c, name, "ns")
+		got.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1, ObservedGeneration: 2}
+		if err := c.Status().Update(ctx, got); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Reconcile(ctx, reconcileReq(name, "ns")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	releaseRegions := func() int {
+		n := 0
+		for _, call := range gc.regionCalls() {
+			if call.id == releaseID {
+				n++
+			}
+		}
+		return n
+	}
+
+	complete("api")
+	if n := releaseRegions(); n != 0 {
+		t.Fatal("expected the release region to stay open while worker rolls")
+	}
+	if _, err := r.Reconcile(ctx, reconcileReq("other", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	complete("worker")
+	if n := releaseRegions(); n != 1 {
+		t.Fatalf("expected the release region to close with the last component, got %d", n)
+	}
+	if n := len(gc.createCalls()); n != 7 {
+		t.Fatalf("expected two release annotations in total (shop and other), got %d creates", n)
+	}
+}
+
+func TestReconcile_ReleaseRegion_ClosesWhenLastComponentDeleted(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	objs := []client.Object{trackedNamespace("ns")}
+	for _, name := range []string{"api", "worker"} {
+		d := deployment(name, "ns", "shop:2.0", 2)
+		d.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.0", helmReleaseAnnotation: "shop"}
+		objs = append(objs, d)
+	}
+	r, c := newReconciler(objs, gc)
+	r.Lifecycle.ReleaseRegions = true
+	ctx := context.Background()
+
+	for _, name := range []string{"api", "worker"} {
+		if _, err := r.Reconcile(ctx, reconcileReq(name, "ns")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	api := getDeployment(t, c, "api", "ns")
+	releaseID, _ := strconv.ParseInt(api.Annotations[ReleaseAnnotation], 10, 64)
+	api.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1, ObservedGeneration: 2}
+	if err := c.Status().Update(ctx, api); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, reconcileReq("api", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	closed := func() bool {
+		return slices.ContainsFunc(gc.regionCalls(), func(call annotationCall) bool { return call.id == releaseID })
+	}
+	if closed() {
+		t.Fatal("expected the release region to stay open while worker rolls")
+	}
+
+	// worker is deleted before its rollout finished.
+	if err := c.Delete(ctx, getDeployment(t, c, "worker", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, reconcileReq("worker", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	if !closed() {
+		t.Fatalf("expected the release region to close with its last component, got %+v", gc.regionCalls())
+	}
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// RolloutHistoryPath is where RolloutHistoryHandler is served on the metrics
+// server.
+const RolloutHistoryPath = "/rollouts"
+
+// RolloutRecord is one finished rollout kept in HistoryAnnotation. The JSON
+// keys are short to keep the annotation compact.
+type RolloutRecord struct {
+	Version string    `json:"v"`
+	Image   string    `json:"img,omitempty"`
+	Start   time.Time `json:"s,omitzero"`
+	End     time.Time `json:"e,omitzero"`
+	Outcome string    `json:"o"`             // completed, timed-out or late
+	IDs     []int64   `json:"ids,omitempty"` // Grafana annotations of the rollout
+}
+
+// parseRolloutHistory decodes HistoryAnnotation, oldest rollout first. A
+// malformed value is treated as empty.
+func parseRolloutHistory(value string) []RolloutRecord {
+	var history []RolloutRecord
+	if value == "" || json.Unmarshal([]byte(value), &history) != nil {
+		return nil
+	}
+	return history
+}
+
+// recordRollout adds the HistoryAnnotation holding rec to patch, keeping the
+// last RolloutHistory rollouts. A rollout already recorded, e.g. as timed-out
+// before its late completion, is replaced. Does nothing when the history is
+// disabled.
+func (l *AnnotationLifecycle) recordRollout(patch, annotations map[string]string, rec RolloutRecord) {
+	if l.RolloutHistory <= 0 {
+		return
+	}
+	if rec.Start.IsZero() {
+		rec.Start, _ = time.Parse(time.RFC3339, annotations[StartTimeAnnotation])
+	}
+	rec.IDs = append(annotationIDs(annotations[StartAnnotation]), rec.IDs...)
+	rec.IDs = append(rec.IDs, annotationIDs(annotations[ReleaseAnnotation])...)
+	history := parseRolloutHistory(annotations[HistoryAnnotation])
+	if n := len(history); n > 0 && history[n-1].Version == rec.Version && history[n-1].Start.Equal(rec.Start) {
+		rec.IDs = append(history[n-1].IDs, rec.IDs...)
+		history = history[:n-1]
+	}
+	rec.IDs = uniqueIDs(rec.IDs)
+	history = append(history, rec)
+	if len(history) > l.RolloutHistory {
+		history = history[len(history)-l.RolloutHistory:]
+	}
+	b, err := json.Marshal(history)
+	if err != nil {
+		return
+	}
+	patch[HistoryAnnotation] = string(b)
+}
+
+// annotationIDs parses the annotation IDs among values, skipping empty and
+// malformed ones.
+func annotationIDs(values ...string) []int64 {
+	var ids []int64
+	for _, v := range values {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// uniqueIDs drops repeated IDs, keeping the first occurrence.
+func uniqueIDs(ids []int64) []int64 {
+	var out []int64
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// RolloutHistoryHandler serves the rollout history of the watched workloads
+// as JSON, so recent rollouts can be inspected without Grafana. The
+// namespace, kind and name query parameters narrow the result. Only
+// workloads of tracked namespaces are served. It does not authenticate
+// requests itself; main only serves it behind the metrics server's
+// authentication and authorization filter.
+type RolloutHistoryHandler struct {
+	Client   client.Reader
+	Adapters []WorkloadAdapter
+}
+
+type workloadRollouts struct {
+	Kind      string           `json:"kind"`
+	Namespace string           `json:"namespace"`
+	Name      string           `json:"name"`
+	Rollouts  []rolloutSummary `json:"rollouts"`
+}
+
+type rolloutSummary struct {
+	Version       string    `json:"version"`
+	Image         string    `json:"image,omitempty"`
+	Start         time.Time `json:"start,omitzero"`
+	End           time.Time `json:"end,omitzero"`
+	Duration      string    `json:"duration,omitempty"`
+	Outcome       string    `json:"outcome"`
+	AnnotationIDs []int64   `json:"annotationIDs,omitempty"`
+}
+
+func (h *RolloutHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	namespace, kind, name := query.Get("namespace"), query.Get("kind"), query.Get("name")
+
+	var namespaces corev1.NamespaceList
+	if err := h.Client.List(r.Context(), &namespaces,
+		client.MatchingLabels{"deployment-annotator": trackingEnabled}); err != nil {
+		log.FromContext(r.Context()).Error(err, "Failed to list tracked namespaces")
+		http.Error(w, "failed to list workloads", http.StatusInternalServerError)
+		return
+	}
+	tracked := map[string]bool{}
+	for _, ns := range namespaces.Items {
+		tracked[ns.Name] = true
+	}
+
+	out := []workloadRollouts{}
+	for _, a := range h.Adapters {
+		if kind != "" && a.Kind() != kind {
+			continue
+		}
+		list := a.NewObjectList()
+		if err := h.Client.List(r.Context(), list, client.InNamespace(namespace)); err != nil {
+			log.FromContext(r.Context()).Error(err, "Failed to list workloads", "kind", a.Kind())
+			http.Error(w, "failed to list workloads", http.StatusInternalServerError)
+			return
+		}
+		for _, obj := range a.ExtractItems(list) {
+			if !tracked[obj.GetNamespace()] || (name != "" && obj.GetName() != name) {
+				continue
+			}
+			history := parseRolloutHistory(obj.GetAnnotations()[HistoryAnnotation])
+			if len(history) == 0 {
+				continue
+			}
+			wr := workloadRollouts{Kind: a.Kind(), Namespace: obj.GetNamespace(), Name: obj.GetName()}
+			for _, rec := range history {
+				s := rolloutSummary{
+					Version: rec.Version, Image: rec.Image, Start: rec.Start, End: rec.End,
+					Outcome: rec.Outcome, AnnotationIDs: rec.IDs,
+				}
+				if !rec.Start.IsZero() && !rec.End.IsZero() {
+					s.Duration = rec.End.Sub(rec.Start).Round(time.Second).String()
+				}
+				wr.Rollouts = append(wr.Rollouts, s)
+			}
+			out = append(out, wr)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
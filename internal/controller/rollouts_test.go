@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcile_RolloutHistory_KeepsLastRollouts(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	started := now.Add(-20 * time.Minute)
+	d := deployment("app", "ns", "nginx:1.21", 1)
+	d.Annotations = map[string]string{
+		VersionAnnotation:   "gen-1-img-1.21",
+		StartAnnotation:     "100",
+		StartTimeAnnotation: started.Format(time.RFC3339),
+		HistoryAnnotation:   `[{"v":"gen-0-a","o":"completed"},{"v":"gen-0-b","o":"completed"}]`,
+	}
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+	r.Lifecycle.RolloutHistory = 2
+	r.Deadline = 10 * time.Minute
+	ctx := context.Background()
+
+	if _, err := r.Reconcile(ctx, reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	history := parseRolloutHistory(getDeployment(t, c, "app", "ns").Annotations[HistoryAnnotation])
+	if len(history) != 2 || history[0].Version != "gen-0-b" || history[1].Outcome != "timed-out" ||
+		!history[1].Start.Equal(started) || !history[1].End.Equal(started.Add(10*time.Minute)) {
+		t.Fatalf("expected the oldest rollout replaced by the timed-out one, got %+v", history)
+	}
+
+	got := getDeployment(t, c, "app", "ns")
+	got.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1, ObservedGeneration: 1}
+	if err := c.Status().Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	history = parseRolloutHistory(getDeployment(t, c, "app", "ns").Annotations[HistoryAnnotation])
+	creates := gc.createCalls()
+	want := []int64{100, creates[0].id, creates[1].id}
+	if len(history) != 2 || history[1].Outcome != "late" || history[1].Image != "nginx:1.21" ||
+		!history[1].End.Equal(now) || !slices.Equal(history[1].IDs, want) {
+		t.Fatalf("expected the late completion to replace the timed-out entry with ids %v, got %+v", want, history)
+	}
+}
+
+func TestRolloutHistoryHandler_ServesHistory(t *testing.T) {
+	start := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	recorded, _ := json.Marshal([]RolloutRecord{{
+		Version: "gen-2-img-1.22", Image: "nginx:1.22", Start: start, End: start.Add(90 * time.Second),
+		Outcome: "completed", IDs: []int64{1, 2},
+	}})
+	d := deployment("app", "ns", "nginx:1.22", 2)
+	d.Annotations = map[string]string{HistoryAnnotation: string(recorded)}
+	// The history of a workload in a namespace that is no longer tracked
+	// stays private.
+	untracked := deployment("app", "other", "nginx:1.22", 2)
+	untracked.Annotations = map[string]string{HistoryAnnotation: string(recorded)}
+	_, c := newReconciler([]client.Object{
+		trackedNamespace("ns"), d, deployment("quiet", "ns", "nginx:1.22", 1),
+		untrackedNamespace("other"), untracked,
+	}, &fakeAnnotationClient{})
+	h := &RolloutHistoryHandler{Client: c, Adapters: []WorkloadAdapter{DeploymentAdapter{}}}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, RolloutHistoryPath+"?namespace=ns", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var out []workloadRollouts
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0].Name != "app" || len(out[0].Rollouts) != 1 ||
+		out[0].Rollouts[0].Duration != "1m30s" || out[0].Rollouts[0].Outcome != "completed" {
+		t.Fatalf("expected the history of app only, got %+v", out)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, RolloutHistoryPath, nil))
+	out = nil
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0].Namespace != "ns" {
+		t.Fatalf("expected workloads of tracked namespaces only, got %+v", out)
+	}
+}
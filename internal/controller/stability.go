@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DefaultUnstableRestarts is the number of container restarts during the
+// watch window that marks a rollout unstable when UnstableRestarts is not set.
+const DefaultUnstableRestarts = 3
+
+// stabilityPollInterval is how often pods are checked during the watch window.
+const stabilityPollInterval = 30 * time.Second
+
+// maxInstabilityDetails caps the containers listed in an unstable annotation.
+const maxInstabilityDetails = 5
+
+// instability is what went wrong with a workload's pods after its rollout.
+type instability struct {
+	restarts int      // container restarts since the watch started
+	problems []string // e.g. "CrashLoopBackOff in app-7d9f/main"
+}
+
+func (i instability) summary() string {
+	parts := []string{plural(i.restarts, "restart")}
+	problems := i.problems
+	if len(problems) > maxInstabilityDetails {
+		problems = append(problems[:maxInstabilityDetails:maxInstabilityDetails],
+			fmt.Sprintf("and %d more", len(i.problems)-maxInstabilityDetails))
+	}
+	return strings.Join(append(parts, problems...), ", ")
+}
+
+// watchValue renders WatchAnnotation: the end of the watch window and, once
+// known, the container restarts counted when the watch started.
+func watchValue(until time.Time, baseline int) string {
+	v := until.UTC().Format(time.RFC3339)
+	if baseline >= 0 {
+		v += "," + strconv.Itoa(baseline)
+	}
+	return v
+}
+
+// parseWatch decodes WatchAnnotation. baseline is -1 until the first check.
+func parseWatch(value string) (until time.Time, baseline int, ok bool) {
+	u, b, _ := strings.Cut(value, ",")
+	until, err := time.Parse(time.RFC3339, u)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	baseline = -1
+	if n, err := strconv.Atoi(b); err == nil {
+		baseline = n
+	}
+	return until, baseline, true
+}
+
+// startWatch adds the WatchAnnotation opening the post-deploy watch window
+// at completedAt to patch. Does nothing when the window is disabled.
+func (l *AnnotationLifecycle) startWatch(patch map[string]string, completedAt time.Time) {
+	if l.WatchWindow > 0 {
+		patch[WatchAnnotation] = watchValue(completedAt.Add(l.WatchWindow), -1)
+	}
+}
+
+// podTrouble counts the container restarts of the running pods and lists
+// the containers crash-looping now or OOM-killed since since.
+func podTrouble(pods []corev1.Pod, since time.Time) instability {
+	var out instability
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			out.restarts += int(cs.RestartCount)
+			where := pod.Name + "/" + cs.Name
+			if w := cs.State.Waiting; w != nil && w.Reason == "CrashLoopBackOff" {
+				out.problems = append(out.problems, "CrashLoopBackOff in "+where)
+			}
+			if t := cs.LastTerminationState.Terminated; t != nil && t.Reason == "OOMKilled" && t.FinishedAt.After(since) {
+				out.problems = append(out.problems, "OOMKilled in "+where)
+			}
+		}
+	}
+	return out
+}
+
+// watchStability checks the pods of a completed rollout during its watch
+// window. The restarts counted at the first check are the baseline; a rollout
+// is unstable once UnstableRestarts more restarts happened, or a container is
+// crash-looping or was OOM-killed. It is then annotated once and the watch
+// ends, as it does when the window elapses.
+func (r *WorkloadReconciler) watchStability(
+	ctx context.Context, obj client.Object, kind, imageRef, imageTag string,
+) (ctrl.Result, error) {
+	l := r.Lifecycle
+	until, baseline, ok := parseWatch(obj.GetAnnotations()[WatchAnnotation])
+	if !ok {
+		return ctrl.Result{}, nil
+	}
+	logger := log.FromContext(ctx)
+	now := l.now()
+	pods, err := r.listPods(ctx, obj)
+	if err != nil {
+		logger.Error(err, "Failed to check pods of completed rollout", "kind", kind)
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	trouble := podTrouble(pods, until.Add(-l.WatchWindow))
+	if baseline < 0 {
+		baseline = trouble.restarts
+		trouble.restarts = 0
+	} else {
+		trouble.restarts = max(trouble.restarts-baseline, 0)
+	}
+	threshold := l.UnstableRestarts
+	if threshold <= 0 {
+		threshold = DefaultUnstableRestarts
+	}
+	if trouble.restarts >= threshold || len(trouble.problems) > 0 {
+		if err := l.RecordInstability(ctx, obj, kind, imageRef, imageTag, trouble); err != nil {
+			return ctrl.Result{RequeueAfter: time.Minute}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	if !now.Before(until) {
+		if err := l.patchAnnotations(ctx, obj, map[string]string{WatchAnnotation: ""}); err != nil {
+			return ctrl.Result{RequeueAfter: time.Minute}, err
+		}
+		logger.V(1).Info("Rollout stable after watch window", "kind", kind)
+		return ctrl.Result{}, nil
+	}
+	if v := watchValue(until, baseline); v != obj.GetAnnotations()[WatchAnnotation] {
+		if err := l.patchAnnotations(ctx, obj, map[string]string{WatchAnnotation: v}); err != nil {
+			return ctrl.Result{RequeueAfter: time.Minute}, err
+		}
+	}
+	return ctrl.Result{RequeueAfter: min(stabilityPollInterval, until.Sub(now))}, nil
+}
+
+// RecordInstability creates the "unstable" annotation of a rollout whose pods
+// misbehaved during the watch window and ends the watch.
+func (l *AnnotationLifecycle) RecordInstability(
+	ctx context.Context, obj client.Object, kind, imageRef, imageTag string, trouble instability,
+) error {
+	logger := log.FromContext(ctx)
+	id, err := l.createOnce(ctx, obj, annotationEvent{
+		obj: obj, kind: kind, name: obj.GetName(), namespace: obj.GetNamespace(),
+		imageRef: imageRef, imageTag: imageTag, eventType: "unstable",
+		text: fmt.Sprintf("Unstable after deploy %s: %s", imageRef, trouble.summary()),
+		tags: rolloutTags(obj.GetAnnotations()),
+	})
+	if err != nil {
+		logger.Error(err, "Failed to create unstable annotation")
+		return err
+	}
+	if err := l.patchAnnotations(ctx, obj, map[string]string{WatchAnnotation: "", PendingAnnotation: ""}); err != nil {
+		logger.Error(err, "Failed to end watch window")
+		return err
+	}
+	logger.Info("Rollout unstable after deploy", "kind", kind, "annotationID", id,
+		"restarts", trouble.restarts, "problems", len(trouble.problems))
+	return nil
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func appPod(name string, restarts int32) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", Labels: map[string]string{"app": "app"}},
+		Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: "main", RestartCount: restarts}}},
+	}
+}
+
+func TestReconcile_WatchWindow_AnnotatesRestarts(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := readyDeployment("app", "ns", "nginx:1.22", 1)
+	d.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.22", StartAnnotation: "100"}
+	pod := appPod("app-1", 1)
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d, pod}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+	r.Lifecycle.WatchWindow = 10 * time.Minute
+	ctx := context.Background()
+
+	res, err := r.Reconcile(ctx, reconcileReq("app", "ns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RequeueAfter != stabilityPollInterval {
+		t.Fatalf("expected the watch to poll, got %+v", res)
+	}
+	if got := getDeployment(t, c, "app", "ns").Annotations[WatchAnnotation]; got != "2025-06-15T12:10:00Z,1" {
+		t.Fatalf("expected the window end and restart baseline, got %q", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	pod.Status.ContainerStatuses[0].RestartCount = 4
+	if err := c.Status().Update(ctx, pod); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	creates := gc.createCalls()
+	last := creates[len(creates)-1]
+	if last.what != "deploy-unstable:app" || last.data != "Unstable after deploy nginx:1.22: 3 restarts" {
+		t.Fatalf("expected an unstable annotation, got %+v", last)
+	}
+	if getDeployment(t, c, "app", "ns").Annotations[WatchAnnotation] != "" {
+		t.Fatal("expected the watch to end once annotated")
+	}
+}
+
+func TestReconcile_WatchWindow_StableOrCrashLooping(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name     string
+		elapsed  time.Duration
+		waiting  string
+		unstable string
+	}{
+		{name: "stable until the window ends", elapsed: 10 * time.Minute},
+		{name: "crash loop", elapsed: time.Minute, waiting: "CrashLoopBackOff",
+			unstable: "Unstable after deploy nginx:1.22: 0 restarts, CrashLoopBackOff in app-1/main"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gc := &fakeAnnotationClient{}
+			d := readyDeployment("app", "ns", "nginx:1.22", 1)
+			d.Annotations = map[string]string{
+				VersionAnnotation: "gen-1-img-1.22", StartAnnotation: "100", EndAnnotation: "101",
+				WatchAnnotation: watchValue(now.Add(10*time.Minute), 2),
+			}
+			pod := appPod("app-1", 2)
+			if tc.waiting != "" {
+				pod.Status.ContainerStatuses[0].State.Waiting = &corev1.ContainerStateWaiting{Reason: tc.waiting}
+			}
+			r, c := newReconciler([]client.Object{trackedNamespace("ns"), d, pod}, gc)
+			r.Lifecycle.Now = func() time.Time { return now.Add(tc.elapsed) }
+			r.Lifecycle.WatchWindow = 10 * time.Minute
+
+			res, err := r.Reconcile(context.Background(), reconcileReq("app", "ns"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.RequeueAfter != 0 || getDeployment(t, c, "app", "ns").Annotations[WatchAnnotation] != "" {
+				t.Fatalf("expected the watch to end, got %+v", res)
+			}
+			creates := gc.createCalls()
+			if tc.unstable == "" && len(creates) != 0 {
+				t.Fatalf("expected no annotation for a stable rollout, got %+v", creates)
+			}
+			if tc.unstable != "" && (len(creates) != 1 || !strings.HasPrefix(creates[0].data, tc.unstable)) {
+				t.Fatalf("expected %q, got %+v", tc.unstable, creates)
+			}
+		})
+	}
+}
+
+func TestReconcile_WatchWindow_WorkloadUnavailable(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	// The crash-looping pod is not available, so neither is the Deployment.
+	d := deployment("app", "ns", "nginx:1.22", 1)
+	d.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 0, ObservedGeneration: 1}
+	d.Annotations = map[string]string{
+		VersionAnnotation: "gen-1-img-1.22", StartAnnotation: "100", EndAnnotation: "101",
+		WatchAnnotation: watchValue(now.Add(10*time.Minute), 0),
+	}
+	pod := appPod("app-1", 1)
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d, pod}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+	r.Lifecycle.WatchWindow = 10 * time.Minute
+	ctx := context.Background()
+
+	res, err := r.Reconcile(ctx, reconcileReq("app", "ns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RequeueAfter != stabilityPollInterval || len(gc.createCalls()) != 0 {
+		t.Fatalf("expected the watch to keep polling, got %+v, %+v", res, gc.createCalls())
+	}
+
+	pod.Status.ContainerStatuses[0].State.Waiting = &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}
+	if err := c.Status().Update(ctx, pod); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	creates := gc.createCalls()
+	if len(creates) != 1 || creates[0].what != "deploy-unstable:app" {
+		t.Fatalf("expected an unstable annotation while the workload is unavailable, got %+v", creates)
+	}
+}
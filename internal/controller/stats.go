@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// statsMaxAge bounds how long samples of a rollout that never completes,
+// e.g. of a deleted workload, are kept.
+const statsMaxAge = 24 * time.Hour
+
+// pulledPattern matches the kubelet's "Pulled" event message, e.g.
+// `Successfully pulled image "nginx:1.22" in 2.345s (2.345s including waiting)`.
+var pulledPattern = regexp.MustCompile(`Successfully pulled image "[^"]*" in ([0-9.]+[a-zµ]+)`)
+
+// podSample is what was seen of one new pod during a rollout.
+type podSample struct {
+	created, ready time.Time
+	restarts       int32
+}
+
+// rolloutSample accumulates the pods of an open rollout across reconciles,
+// so pods replaced before the rollout completed still count.
+type rolloutSample struct {
+	firstSeen         time.Time
+	pods              map[types.UID]*podSample
+	pulls             []time.Duration
+	schedulingRetries int
+	events            map[types.UID]bool // events already counted
+}
+
+// rolloutStats holds the samples of open rollouts in memory, keyed by
+// workload and start annotation. Samples taken before a controller restart
+// are lost; the final sample at completion still covers the current pods.
+type rolloutStats struct {
+	mu      sync.Mutex
+	samples map[string]*rolloutSample
+}
+
+// statsKey identifies one rollout of a workload.
+func statsKey(obj client.Object, kind string) string {
+	return kind + "/" + obj.GetNamespace() + "/" + obj.GetName() + "/" + obj.GetAnnotations()[StartAnnotation]
+}
+
+// add records pods into the sample of rollout key and, when events are
+// given, the image pulls and scheduling retries of the sampled pods.
+func (s *rolloutStats) add(key string, pods []corev1.Pod, events []corev1.Event, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.samples == nil {
+		s.samples = map[string]*rolloutSample{}
+	}
+	for k, sample := range s.samples {
+		if now.Sub(sample.firstSeen) > statsMaxAge {
+			delete(s.samples, k)
+		}
+	}
+	sample := s.samples[key]
+	if sample == nil {
+		sample = &rolloutSample{firstSeen: now, pods: map[types.UID]*podSample{}, events: map[types.UID]bool{}}
+		s.samples[key] = sample
+	}
+	for _, pod := range pods {
+		p := sample.pods[pod.UID]
+		if p == nil {
+			p = &podSample{created: pod.CreationTimestamp.Time}
+			sample.pods[pod.UID] = p
+		}
+		var restarts int32
+		for _, cs := range pod.Status.ContainerStatuses {
+			restarts += cs.RestartCount
+		}
+		p.restarts = max(p.restarts, restarts)
+		for _, c := range pod.Status.Conditions {
+			if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue && p.ready.IsZero() {
+				p.ready = c.LastTransitionTime.Time
+			}
+		}
+	}
+	for _, ev := range events {
+		if ev.InvolvedObject.Kind != "Pod" || sample.pods[ev.InvolvedObject.UID] == nil || sample.events[ev.UID] {
+			continue
+		}
+		sample.events[ev.UID] = true
+		switch ev.Reason {
+		case "Pulled":
+			if m := pulledPattern.FindStringSubmatch(ev.Message); m != nil {
+				if d, err := time.ParseDuration(m[1]); err == nil {
+					sample.pulls = append(sample.pulls, d)
+				}
+			}
+		case "FailedScheduling":
+			count := ev.Count
+			if ev.Series != nil {
+				count = ev.Series.Count
+			}
+			sample.schedulingRetries += int(max(count, 1))
+		}
+	}
+}
+
+// get returns the sample of rollout key, or nil.
+func (s *rolloutStats) get(key string) *rolloutSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.samples[key]
+}
+
+// take removes and returns the sample of rollout key, or nil.
+func (s *rolloutStats) take(key string) *rolloutSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sample := s.samples[key]
+	delete(s.samples, key)
+	return sample
+}
+
+// readyTimes returns the creation-to-ready time of every pod that became ready.
+func (s *rolloutSample) readyTimes() []time.Duration {
+	var out []time.Duration
+	for _, p := range s.pods {
+		if !p.ready.IsZero() && !p.created.IsZero() && !p.ready.Before(p.created) {
+			out = append(out, p.ready.Sub(p.created))
+		}
+	}
+	return out
+}
+
+func (s *rolloutSample) restarts() int {
+	n := 0
+	for _, p := range s.pods {
+		n += int(p.restarts)
+	}
+	return n
+}
+
+// summary renders e.g. "4 pods ready in p50 12s, max 31s; 1 restart; image
+// pulls p50 3.2s, max 8.1s; 2 scheduling retries".
+func (s *rolloutSample) summary() string {
+	parts := []string{plural(len(s.pods), "pod")}
+	if ready := s.readyTimes(); len(ready) > 0 {
+		p50, peak := spread(ready)
+		parts[0] += fmt.Sprintf(" ready in p50 %s, max %s", p50.Round(time.Second), peak.Round(time.Second))
+	}
+	parts = append(parts, plural(s.restarts(), "restart"))
+	if len(s.pulls) > 0 {
+		p50, peak := spread(s.pulls)
+		parts = append(parts, fmt.Sprintf("image pulls p50 %s, max %s",
+			p50.Round(100*time.Millisecond), peak.Round(100*time.Millisecond)))
+	}
+	retries := fmt.Sprintf("%d scheduling retries", s.schedulingRetries)
+	if s.schedulingRetries == 1 {
+		retries = "1 scheduling retry"
+	}
+	return strings.Join(append(parts, retries), "; ")
+}
+
+// tags renders the summary as key:value tags, for annotations whose text
+// cannot change such as regions. A nil sample has none.
+func (s *rolloutSample) tags() []string {
+	if s == nil {
+		return nil
+	}
+	tags := []string{
+		fmt.Sprintf("pods:%d", len(s.pods)),
+		fmt.Sprintf("restarts:%d", s.restarts()),
+		fmt.Sprintf("scheduling-retries:%d", s.schedulingRetries),
+	}
+	if ready := s.readyTimes(); len(ready) > 0 {
+		p50, peak := spread(ready)
+		tags = append(tags, "ready-p50:"+p50.Round(time.Second).String(), "ready-max:"+peak.Round(time.Second).String())
+	}
+	if len(s.pulls) > 0 {
+		p50, peak := spread(s.pulls)
+		tags = append(tags, "pull-p50:"+p50.Round(100*time.Millisecond).String(),
+			"pull-max:"+peak.Round(100*time.Millisecond).String())
+	}
+	return tags
+}
+
+// spread returns the median and the maximum of ds, which must not be empty.
+func spread(ds []time.Duration) (p50, peak time.Duration) {
+	sorted := slices.Clone(ds)
+	slices.Sort(sorted)
+	return sorted[(len(sorted)-1)/2], sorted[len(sorted)-1]
+}
+
+// observe exports the sample of a completed rollout as metrics.
+func (s *rolloutSample) observe(kind, namespace string) {
+	for _, d := range s.readyTimes() {
+		podReadySeconds.WithLabelValues(kind, namespace).Observe(d.Seconds())
+	}
+	for _, d := range s.pulls {
+		imagePullSeconds.WithLabelValues(kind, namespace).Observe(d.Seconds())
+	}
+	rolloutPodRestarts.WithLabelValues(kind, namespace).Observe(float64(s.restarts()))
+	rolloutSchedulingRetries.WithLabelValues(kind, namespace).Observe(float64(s.schedulingRetries))
+}
+
+// sampleRollout records the new pods of an open rollout for its statistics.
+// At completion (final) it also reads the pod events for image pulls and
+// scheduling retries, which the kubelet and scheduler only report there.
+func (r *WorkloadReconciler) sampleRollout(ctx context.Context, obj client.Object, kind string, final bool) {
+	l := r.Lifecycle
+	annotations := obj.GetAnnotations()
+	open := annotations[StartAnnotation] != "" &&
+		(annotations[EndAnnotation] == "" || annotations[TimedOutAnnotation] != "")
+	if !l.RolloutStats || !open {
+		return
+	}
+	logger := log.FromContext(ctx)
+	pods, err := r.currentPods(ctx, obj)
+	if err != nil {
+		logger.Error(err, "Failed to list pods for rollout statistics", "kind", kind)
+		return
+	}
+	var events []corev1.Event
+	if final {
+		var reader client.Reader = r.Client
+		if r.APIReader != nil {
+			reader = r.APIReader
+		}
+		var list corev1.EventList
+		if err := reader.List(ctx, &list, client.InNamespace(obj.GetNamespace()),
+			client.MatchingFields{"involvedObject.kind": "Pod"}); err != nil {
+			logger.Error(err, "Failed to list events for rollout statistics", "kind", kind)
+		}
+		events = list.Items
+	}
+	l.stats.add(statsKey(obj, kind), pods, events, l.now())
+}
@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcile_RolloutStats_SummarizesPodsAtCompletion(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := deployment("app", "ns", "nginx:1.22", 2)
+	d.Annotations = map[string]string{VersionAnnotation: "gen-2-img-1.22", StartAnnotation: "100"}
+	statsPod := func(name string, readyAfter time.Duration, restarts int32) *corev1.Pod {
+		p := appPod(name, restarts)
+		p.UID = types.UID(name + "-uid")
+		p.CreationTimestamp = metav1.NewTime(now.Add(-time.Minute))
+		p.Status.Conditions = []corev1.PodCondition{{
+			Type: corev1.PodReady, Status: corev1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(now.Add(-time.Minute + readyAfter)),
+		}}
+		return p
+	}
+	replaced := statsPod("app-1", 40*time.Second, 1)
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d, replaced}, gc)
+	r.Lifecycle.Now = func() time.Time { return now }
+	r.Lifecycle.RolloutStats = true
+	ctx := context.Background()
+
+	// The first pod is sampled while the rollout is open, then replaced.
+	if _, err := r.Reconcile(ctx, reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, replaced); err != nil {
+		t.Fatal(err)
+	}
+	event := func(name, pod, reason, message string, count int32) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "ns", UID: types.UID(name)},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "ns", Name: pod, UID: types.UID(pod + "-uid")},
+			Reason:         reason, Message: message, Count: count,
+		}
+	}
+	for _, obj := range []client.Object{
+		statsPod("app-2", 12*time.Second, 0),
+		event("pulled-1", "app-1", "Pulled", `Successfully pulled image "nginx:1.22" in 8.123s (8.123s including waiting)`, 1),
+		event("pulled-2", "app-2", "Pulled", `Successfully pulled image "nginx:1.22" in 3.2s (3.2s including waiting)`, 1),
+		event("scheduling-2", "app-2", "FailedScheduling", "0/3 nodes are available", 2),
+		event("other", "unrelated", "FailedScheduling", "0/3 nodes are available", 5),
+	} {
+		if err := c.Create(ctx, obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := getDeployment(t, c, "app", "ns")
+	got.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1, ObservedGeneration: 2}
+	if err := c.Status().Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, reconcileReq("app", "ns")); err != nil {
+		t.Fatal(err)
+	}
+
+	creates := gc.createCalls()
+	if len(creates) != 1 {
+		t.Fatalf("expected a completion annotation, got %+v", creates)
+	}
+	want := "Completed deployment nginx:1.22 — 2 pods ready in p50 12s, max 40s; 1 restart; " +
+		"image pulls p50 3.2s, max 8.1s; 2 scheduling retries"
+	if creates[0].data != want {
+		t.Fatalf("expected %q, got %q", want, creates[0].data)
+	}
+	if r.Lifecycle.stats.take(statsKey(got, "deployment")) != nil {
+		t.Fatal("expected the sample to be released at completion")
+	}
+}
+
+func TestStartDeployment_RolloutStats_DroppedWhenJoiningBurst(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := deployment("app", "ns", "nginx:1.22", 2)
+	d.Annotations = map[string]string{VersionAnnotation: "gen-2-img-1.22", StartAnnotation: "100"}
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+	l := r.Lifecycle
+	l.Now = func() time.Time { return now }
+	l.Bursts = &BurstAggregator{Threshold: 1, Window: time.Minute}
+	ctx := context.Background()
+	got := getDeployment(t, c, "app", "ns")
+	key := statsKey(got, "deployment")
+	l.stats.add(key, []corev1.Pod{*appPod("app-1", 0)}, nil, now)
+	l.Bursts.join(burstMember{kind: "deployment", namespace: "ns", name: "other", started: now}, now)
+
+	if err := l.StartDeployment(ctx, got, "deployment", "gen-3-img-1.23", "nginx:1.23", "1.23",
+		rolloutChange{}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Annotations[BurstAnnotation] == "" {
+		t.Fatalf("expected the rollout to join the burst, got %v", got.Annotations)
+	}
+	if l.stats.get(key) != nil {
+		t.Fatal("expected the sample of the replaced rollout to be dropped")
+	}
+}
+
+func TestComplete_RolloutStats_KeptUntilStoredAndTaggedOnRegions(t *testing.T) {
+	gc := &fakeAnnotationClient{}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	d := readyDeployment("app", "ns", "nginx:1.22", 1)
+	d.Annotations = map[string]string{VersionAnnotation: "gen-1-img-1.22", StartAnnotation: "100"}
+	r, c := newReconciler([]client.Object{trackedNamespace("ns"), d}, gc)
+	l := r.Lifecycle
+	l.Now = func() time.Time { return now }
+	l.RolloutStats = true
+	l.Style = AnnotationStyleRegion
+	ctx := context.Background()
+
+	stale := getDeployment(t, c, "app", "ns")
+	pods := []corev1.Pod{*appPod("app-1", 0), *appPod("app-2", 2)}
+	pods[0].UID, pods[1].UID = "uid-1", "uid-2"
+	l.stats.add(statsKey(stale, "deployment"), pods, nil, now)
+	// A concurrent status update makes the copy stale, so storing the end fails.
+	fresh := stale.DeepCopy()
+	if err := c.Status().Update(ctx, fresh); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.CompleteDeployment(ctx, stale, "deployment", "nginx:1.22", "1.22", now); err == nil {
+		t.Fatal("expected the stale patch to fail")
+	}
+	if l.stats.get(statsKey(stale, "deployment")) == nil {
+		t.Fatal("expected the sample to survive the failed completion")
+	}
+
+	if err := l.CompleteDeployment(ctx, getDeployment(t, c, "app", "ns"), "deployment", "nginx:1.22", "1.22", now); err != nil {
+		t.Fatal(err)
+	}
+	regions := gc.regionCalls()
+	last := regions[len(regions)-1]
+	if !slices.Contains(last.tags, "pods:2") || !slices.Contains(last.tags, "restarts:2") {
+		t.Fatalf("expected the statistics in the region tags, got %v", last.tags)
+	}
+	if l.stats.get(statsKey(stale, "deployment")) != nil {
+		t.Fatal("expected the sample to be released once the completion is stored")
+	}
+}
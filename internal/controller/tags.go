@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// TagSchema selects how the standard annotation tags are laid out.
+type TagSchema string
+
+const (
+	// TagSchemaLegacy emits positional tags: deploy, namespace, name, image
+	// tag, event, kind. It is the default, for existing dashboards.
+	TagSchemaLegacy TagSchema = "legacy"
+	// TagSchemaStructured emits key:value tags (namespace:x, workload:y,
+	// kind:z, image-tag:t, event:e), so tag filters cannot collide.
+	TagSchemaStructured TagSchema = "structured"
+)
+
+// baseTags returns the standard tags identifying a workload event.
+func (l *AnnotationLifecycle) baseTags(kind, namespace, name, imageTag, event string) []string {
+	ns := sanitizeForLog(namespace)
+	n := sanitizeForLog(name)
+	tag := sanitizeForLog(imageTag)
+	if l.TagSchema != TagSchemaStructured {
+		return []string{"deploy", ns, n, tag, event, kind}
+	}
+	tags := []string{"deploy", "namespace:" + ns, "workload:" + n, "kind:" + kind}
+	if tag != "" {
+		tags = append(tags, "image-tag:"+tag)
+	}
+	return append(tags, "event:"+event)
+}
+
+// flagTag returns a tag qualifying an event, e.g. a milestone name or an
+// outcome: the bare value in the legacy schema, key:value in the structured one.
+func (l *AnnotationLifecycle) flagTag(key, value string) string {
+	if l.TagSchema == TagSchemaStructured {
+		return key + ":" + value
+	}
+	return value
+}
+
+// metadataTags copies the configured label and annotation keys of the
+// workload into key:value tags. With TagNamespaceMetadata, keys missing on
+// the workload are looked up on its namespace. obj may be nil for workloads
+// that are already gone, in which case only the namespace is consulted.
+func (l *AnnotationLifecycle) metadataTags(ctx context.Context, obj client.Object, namespace string) []string {
+	if len(l.TagLabelKeys) == 0 && len(l.TagAnnotationKeys) == 0 {
+		return nil
+	}
+	var labels, annotations []map[string]string
+	if obj != nil {
+		labels = append(labels, obj.GetLabels())
+		annotations = append(annotations, obj.GetAnnotations())
+	}
+	if l.TagNamespaceMetadata {
+		var ns corev1.Namespace
+		if err := l.Client.Get(ctx, client.ObjectKey{Name: namespace}, &ns); err != nil {
+			log.FromContext(ctx).V(1).Info("Cannot read namespace metadata for tags",
+				"namespace", sanitizeForLog(namespace), "error", err.Error())
+		} else {
+			labels = append(labels, ns.Labels)
+			annotations = append(annotations, ns.Annotations)
+		}
+	}
+
+	var tags []string
+	lookup := func(keys []string, sources []map[string]string) {
+		for _, k := range keys {
+			for _, m := range sources {
+				if v, ok := m[k]; ok && v != "" {
+					tags = append(tags, sanitizeForLog(k+":"+v))
+					break
+				}
+			}
+		}
+	}
+	lookup(l.TagLabelKeys, labels)
+	lookup(l.TagAnnotationKeys, annotations)
+	return tags
+}
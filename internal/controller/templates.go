@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// templateEvents are the event types annotation templates can be defined for.
+// "region" only supports a tags template: the region keeps the text of the
+// start annotation.
+var templateEvents = []string{
+	"started", "completed", "deleted", "region", "milestone", "timed-out", "backfill",
+	"tracking-enabled", "tracking-disabled", "deleting", "namespace-deleted", "burst", "release",
+	"unstable", "availability-dip",
+}
+
+// AnnotationText is the rendered what/text/tags of one annotation.
+type AnnotationText struct {
+	What string
+	Text string
+	Tags []string
+}
+
+// TemplateData is the data available to annotation templates.
+type TemplateData struct {
+	Event       string
+	Kind        string
+	Name        string
+	Namespace   string
+	Version     string
+	ImageRef    string
+	ImageTag    string
+	Changes     []string
+	Summary     string
+	Labels      map[string]string
+	Annotations map[string]string
+	Object      client.Object // nil for deletions
+	Time        time.Time     // when this annotation is created
+	StartTime   time.Time     // when the rollout started; zero if unknown
+	Duration    time.Duration // Time - StartTime; zero if StartTime is unknown
+	Default     AnnotationText
+}
+
+// AnnotationTemplates holds the configured Go text/templates per event type.
+// A nil *AnnotationTemplates renders the defaults.
+type AnnotationTemplates struct {
+	events map[string]eventTemplates
+}
+
+type eventTemplates struct {
+	what, text, tags *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// ParseAnnotationTemplates parses a JSON object of the form
+// {"started": {"what": "...", "text": "...", "tags": "..."}, ...}.
+// Event types or templates that fail to parse are skipped and reported in the
+// returned error; the remaining templates are still returned, so a single bad
+// template falls back to the default instead of disabling all of them.
+func ParseAnnotationTemplates(raw string) (*AnnotationTemplates, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var cfg map[string]struct {
+		What string `json:"what"`
+		Text string `json:"text"`
+		Tags string `json:"tags"`
+	}
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return nil, fmt.Errorf("parse annotation templates: %w", err)
+	}
+
+	t := &AnnotationTemplates{events: map[string]eventTemplates{}}
+	var errs []error
+	for event, c := range cfg {
+		if !slices.Contains(templateEvents, event) {
+			errs = append(errs, fmt.Errorf("annotation templates: unknown event type %q", event))
+			continue
+		}
+		var et eventTemplates
+		for _, f := range []struct {
+			field string
+			src   string
+			dst   **template.Template
+		}{
+			{"what", c.What, &et.what},
+			{"text", c.Text, &et.text},
+			{"tags", c.Tags, &et.tags},
+		} {
+			if f.src == "" {
+				continue
+			}
+			tmpl, err := template.New(event + "." + f.field).Funcs(templateFuncs).Option("missingkey=error").Parse(f.src)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("annotation templates: %w", err))
+				continue
+			}
+			*f.dst = tmpl
+		}
+		t.events[event] = et
+	}
+	return t, errors.Join(errs...)
+}
+
+// render applies the templates for data.Event on top of data.Default. A
+// template that fails to execute is logged and its default is kept.
+func (t *AnnotationTemplates) render(ctx context.Context, data TemplateData) AnnotationText {
+	out := data.Default
+	if t == nil {
+		return out
+	}
+	et, ok := t.events[data.Event]
+	if !ok {
+		return out
+	}
+	exec := func(tmpl *template.Template) (string, bool) {
+		if tmpl == nil {
+			return "", false
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			log.FromContext(ctx).Error(err, "Annotation template failed, using default", "template", tmpl.Name())
+			return "", false
+		}
+		return b.String(), true
+	}
+	if s, ok := exec(et.what); ok {
+		out.What = sanitizeForLog(strings.TrimSpace(s))
+	}
+	if s, ok := exec(et.text); ok {
+		out.Text = sanitizeForLog(strings.TrimSpace(s))
+	}
+	if s, ok := exec(et.tags); ok {
+		out.Tags = splitTags(s)
+	}
+	return out
+}
+
+// splitTags turns comma- or newline-separated template output into tags.
+func splitTags(s string) []string {
+	tags := []string{}
+	for _, tag := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if tag = sanitizeForLog(strings.TrimSpace(tag)); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
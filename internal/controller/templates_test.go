@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestParseAnnotationTemplates_SkipsInvalidEntries(t *testing.T) {
+	tmpl, err := ParseAnnotationTemplates(`{
+		"started": {"text": "{{ .Default.Text }} ({{ .Version }})"},
+		"completed": {"text": "{{ .Broken"},
+		"restarted": {"text": "x"}
+	}`)
+	if err == nil {
+		t.Fatal("expected the broken template and unknown event to be reported")
+	}
+	if tmpl == nil {
+		t.Fatal("expected valid templates to be kept")
+	}
+
+	def := AnnotationText{What: "deploy-start:app", Text: "Started deployment nginx:1.21", Tags: []string{"deploy"}}
+	got := tmpl.render(context.Background(), TemplateData{Event: "started", Version: "v2", Default: def})
+	if got.Text != "Started deployment nginx:1.21 (v2)" || got.What != def.What {
+		t.Fatalf("unexpected render: %+v", got)
+	}
+	if got := tmpl.render(context.Background(), TemplateData{Event: "completed", Default: def}); got.Text != def.Text {
+		t.Fatalf("expected default text for the broken template, got %q", got.Text)
+	}
+}
+
+func TestAnnotationTemplates_ExecErrorFallsBack(t *testing.T) {
+	tmpl, err := ParseAnnotationTemplates(`{"started": {
+		"tags": "{{ join .Default.Tags \",\" }},team:{{ index .Labels \"team\" }}",
+		"what": "{{ .Missing }}"
+	}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := AnnotationText{What: "deploy-start:app", Tags: []string{"deploy", "ns"}}
+	got := tmpl.render(context.Background(), TemplateData{
+		Event: "started", Labels: map[string]string{"team": "payments"}, Default: def,
+	})
+	if got.What != def.What {
+		t.Fatalf("expected default what after exec error, got %q", got.What)
+	}
+	if want := []string{"deploy", "ns", "team:payments"}; !slices.Equal(got.Tags, want) {
+		t.Fatalf("got tags %v, want %v", got.Tags, want)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -14,7 +15,6 @@ type Client struct {
 	URL        string
 	APIKey     string
 	HTTPClient *http.Client
-	Now        func() time.Time // optional; defaults to time.Now
 }
 
 type Annotation struct {
@@ -28,18 +28,23 @@ type AnnotationResponse struct {
 	ID int64 `json:"id"`
 }
 
+// FoundAnnotation is one entry of an annotation search result.
+type FoundAnnotation struct {
+	ID   int64    `json:"id"`
+	Tags []string `json:"tags"`
+}
+
 type AnnotationPatch struct {
 	TimeEnd  int64    `json:"timeEnd"`
 	IsRegion bool     `json:"isRegion"`
 	Tags     []string `json:"tags"`
 }
 
-func (c *Client) CreateAnnotation(ctx context.Context, what string, tags []string, data string) (int64, error) {
-	now := time.Now
-	if c.Now != nil {
-		now = c.Now
-	}
-	payload := Annotation{What: what, Tags: tags, Data: data, When: now().Unix()}
+// CreateAnnotation creates a point annotation at when.
+func (c *Client) CreateAnnotation(
+	ctx context.Context, what string, tags []string, data string, when time.Time,
+) (int64, error) {
+	payload := Annotation{What: what, Tags: tags, Data: data, When: when.Unix()}
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return 0, fmt.Errorf("marshal: %w", err)
@@ -72,12 +77,9 @@ func (c *Client) CreateAnnotation(ctx context.Context, what string, tags []strin
 	return r.ID, nil
 }
 
-func (c *Client) UpdateAnnotationToRegion(ctx context.Context, id int64, tags []string) error {
-	now := time.Now
-	if c.Now != nil {
-		now = c.Now
-	}
-	patch := AnnotationPatch{TimeEnd: now().UnixMilli(), IsRegion: true, Tags: tags}
+// UpdateAnnotationToRegion turns annotation id into a region ending at end.
+func (c *Client) UpdateAnnotationToRegion(ctx context.Context, id int64, end time.Time, tags []string) error {
+	patch := AnnotationPatch{TimeEnd: end.UnixMilli(), IsRegion: true, Tags: tags}
 	jsonData, err := json.Marshal(patch)
 	if err != nil {
 		return fmt.Errorf("marshal: %w", err)
@@ -105,3 +107,39 @@ func (c *Client) UpdateAnnotationToRegion(ctx context.Context, id int64, tags []
 	}
 	return nil
 }
+
+// FindAnnotations returns the IDs of annotations carrying all of tags.
+func (c *Client) FindAnnotations(ctx context.Context, tags []string) ([]int64, error) {
+	q := url.Values{"type": {"annotation"}, "limit": {"100"}}
+	for _, t := range tags {
+		q.Add("tags", t)
+	}
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf("%s/api/annotations?%s", c.URL, q.Encode()),
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("grafana %d: %s", resp.StatusCode, string(body))
+	}
+	var found []FoundAnnotation
+	if err := json.NewDecoder(resp.Body).Decode(&found); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	ids := make([]int64, 0, len(found))
+	for _, a := range found {
+		ids = append(ids, a.ID)
+	}
+	return ids, nil
+}
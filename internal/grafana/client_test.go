@@ -5,15 +5,14 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 )
 
 var fixedTime = time.Date(2025, 6, 15, 12, 30, 45, 0, time.UTC)
 
-func fixedNow() time.Time { return fixedTime }
-
-func TestCreateAnnotation_UsesInjectedTime(t *testing.T) {
+func TestCreateAnnotation_UsesGivenTime(t *testing.T) {
 	var got Annotation
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
@@ -23,8 +22,8 @@ func TestCreateAnnotation_UsesInjectedTime(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	c := &Client{URL: srv.URL, APIKey: "test", HTTPClient: srv.Client(), Now: fixedNow}
-	id, err := c.CreateAnnotation(context.Background(), "deploy-start:app", []string{"deploy"}, "data")
+	c := &Client{URL: srv.URL, APIKey: "test", HTTPClient: srv.Client()}
+	id, err := c.CreateAnnotation(context.Background(), "deploy-start:app", []string{"deploy"}, "data", fixedTime)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -36,7 +35,7 @@ func TestCreateAnnotation_UsesInjectedTime(t *testing.T) {
 	}
 }
 
-func TestUpdateAnnotationToRegion_UsesInjectedTime(t *testing.T) {
+func TestUpdateAnnotationToRegion_UsesGivenTime(t *testing.T) {
 	var got AnnotationPatch
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
@@ -46,8 +45,8 @@ func TestUpdateAnnotationToRegion_UsesInjectedTime(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	c := &Client{URL: srv.URL, APIKey: "test", HTTPClient: srv.Client(), Now: fixedNow}
-	err := c.UpdateAnnotationToRegion(context.Background(), 1, []string{"deploy", "region"})
+	c := &Client{URL: srv.URL, APIKey: "test", HTTPClient: srv.Client()}
+	err := c.UpdateAnnotationToRegion(context.Background(), 1, fixedTime, []string{"deploy", "region"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -59,24 +58,26 @@ func TestUpdateAnnotationToRegion_UsesInjectedTime(t *testing.T) {
 	}
 }
 
-func TestCreateAnnotation_DefaultsToTimeNow(t *testing.T) {
-	var got Annotation
+func TestFindAnnotations_QueriesByTags(t *testing.T) {
+	var query map[string][]string
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
-			t.Fatal(err)
+		if r.Method != http.MethodGet || r.URL.Path != "/api/annotations" {
+			t.Fatalf("unexpected request %s %s", r.Method, r.URL.Path)
 		}
-		_ = json.NewEncoder(w).Encode(AnnotationResponse{ID: 1})
+		query = r.URL.Query()
+		_ = json.NewEncoder(w).Encode([]FoundAnnotation{{ID: 7}, {ID: 9}})
 	}))
 	defer srv.Close()
 
-	before := time.Now().Unix()
 	c := &Client{URL: srv.URL, APIKey: "test", HTTPClient: srv.Client()}
-	_, err := c.CreateAnnotation(context.Background(), "w", []string{}, "d")
+	ids, err := c.FindAnnotations(context.Background(), []string{"backfill", "backfill:deployment/ns/app-1"})
 	if err != nil {
 		t.Fatal(err)
 	}
-	after := time.Now().Unix()
-	if got.When < before || got.When > after {
-		t.Fatalf("when %d not in [%d, %d]", got.When, before, after)
+	if !slices.Equal(ids, []int64{7, 9}) {
+		t.Fatalf("got ids %v, want [7 9]", ids)
+	}
+	if !slices.Equal(query["tags"], []string{"backfill", "backfill:deployment/ns/app-1"}) {
+		t.Fatalf("got tags query %v", query["tags"])
 	}
 }
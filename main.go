@@ -2,6 +2,8 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"os"
 	goruntime "runtime"
@@ -16,8 +18,12 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 const httpTimeout = 30 * time.Second
@@ -39,15 +45,31 @@ func main() {
 		"version", version, "commit", commit, "buildTime", buildTime,
 		"goVersion", goruntime.Version(), "os", goruntime.GOOS, "arch", goruntime.GOARCH)
 
+	if len(os.Args) > 1 && os.Args[1] == "remove-finalizers" {
+		os.Exit(removeFinalizers(scheme))
+	}
+
 	grafanaURL := requireEnv("GRAFANA_URL")
 	grafanaKey := requireEnv("GRAFANA_API_KEY")
 
+	// Secure serving puts the metrics port, and the rollout history served
+	// on it, behind HTTPS with Kubernetes authentication and authorization.
+	metricsSecure := envBool("METRICS_SECURE", false)
+	metricsOptions := server.Options{BindAddress: ":8081", SecureServing: metricsSecure}
+	if metricsSecure {
+		metricsOptions.FilterProvider = filters.WithAuthenticationAndAuthorization
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		Logger:                 ctrl.Log.WithName("manager"),
-		Metrics:                server.Options{BindAddress: ":8081"},
+		Metrics:                metricsOptions,
 		HealthProbeBindAddress: ":8080",
 		LeaderElection:         false,
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    envInt("WEBHOOK_PORT", 9443),
+			CertDir: os.Getenv("WEBHOOK_CERT_DIR"),
+		}),
 	})
 	if err != nil {
 		logger.Error(err, "Failed to create manager")
@@ -61,17 +83,88 @@ func main() {
 	}
 
 	adapters := []struct {
-		envKey  string
-		adapter controller.WorkloadAdapter
+		envKey      string
+		deadlineKey string
+		adapter     controller.WorkloadAdapter
 	}{
-		{"WATCH_DEPLOYMENTS", controller.DeploymentAdapter{}},
-		{"WATCH_STATEFULSETS", controller.StatefulSetAdapter{}},
-		{"WATCH_DAEMONSETS", controller.DaemonSetAdapter{}},
+		{"WATCH_DEPLOYMENTS", "DEPLOYMENT_ROLLOUT_DEADLINE", controller.DeploymentAdapter{}},
+		{"WATCH_STATEFULSETS", "STATEFULSET_ROLLOUT_DEADLINE", controller.StatefulSetAdapter{}},
+		{"WATCH_DAEMONSETS", "DAEMONSET_ROLLOUT_DEADLINE", controller.DaemonSetAdapter{}},
+	}
+	templates, err := controller.ParseAnnotationTemplates(os.Getenv("ANNOTATION_TEMPLATES"))
+	if err != nil {
+		logger.Error(err, "Invalid annotation templates, affected events use the default text and tags")
+	}
+
+	tagSchema := controller.TagSchema(envString("TAG_SCHEMA", string(controller.TagSchemaLegacy)))
+	if tagSchema != controller.TagSchemaLegacy && tagSchema != controller.TagSchemaStructured {
+		logger.Info("Unknown TAG_SCHEMA, using legacy tags", "tagSchema", tagSchema)
+		tagSchema = controller.TagSchemaLegacy
+	}
+
+	style := controller.AnnotationStyle(envString("ANNOTATION_STYLE", string(controller.AnnotationStyleThreePhase)))
+	switch style {
+	case controller.AnnotationStyleThreePhase, controller.AnnotationStyleRegion, controller.AnnotationStylePoints:
+	default:
+		logger.Info("Unknown ANNOTATION_STYLE, using three-phase", "annotationStyle", style)
+		style = controller.AnnotationStyleThreePhase
 	}
+
+	var bursts *controller.BurstAggregator
+	if threshold := envInt("BURST_THRESHOLD", 0); threshold > 0 {
+		groupBy := controller.BurstGrouping(envString("BURST_GROUP_BY", string(controller.BurstGroupCluster)))
+		switch groupBy {
+		case controller.BurstGroupCluster, controller.BurstGroupNamespace, controller.BurstGroupImage:
+		default:
+			logger.Info("Unknown BURST_GROUP_BY, grouping bursts cluster-wide", "burstGroupBy", groupBy)
+			groupBy = controller.BurstGroupCluster
+		}
+		bursts = &controller.BurstAggregator{
+			Threshold: threshold,
+			Window:    envDuration("BURST_WINDOW", controller.DefaultBurstWindow),
+			GroupBy:   groupBy,
+		}
+	}
+
 	lc := &controller.AnnotationLifecycle{
-		Client:  mgr.GetClient(),
-		GClient: gc,
+		Client:               mgr.GetClient(),
+		GClient:              gc,
+		APIReader:            mgr.GetAPIReader(),
+		Started:              time.Now(),
+		Style:                style,
+		TrackDeletion:        envBool("DELETION_FINALIZER", false),
+		Bursts:               bursts,
+		ReleaseRegions:       envBool("HELM_RELEASE_REGIONS", false),
+		RolloutHistory:       envInt("ROLLOUT_HISTORY", 0),
+		EnvironmentLabel:     os.Getenv("ENVIRONMENT_LABEL"),
+		PromotionOrder:       envList("PROMOTION_ENVIRONMENTS", nil),
+		RolloutStats:         envBool("ROLLOUT_STATS", false),
+		AvailabilityDips:     envBool("AVAILABILITY_DIPS", false),
+		WatchWindow:          envDuration("POST_DEPLOY_WATCH", 0),
+		UnstableRestarts:     envInt("UNSTABLE_RESTART_THRESHOLD", controller.DefaultUnstableRestarts),
+		Backfill:             envInt("BACKFILL_REVISIONS", 0),
+		Milestones:           envBool("ANNOTATE_MILESTONES", false),
+		RedactEnvPatterns:    envList("REDACT_ENV_PATTERNS", controller.DefaultRedactEnvPatterns),
+		TagSchema:            tagSchema,
+		TagLabelKeys:         envList("TAG_LABEL_KEYS", nil),
+		TagAnnotationKeys:    envList("TAG_ANNOTATION_KEYS", nil),
+		TagNamespaceMetadata: envBool("TAG_NAMESPACE_METADATA", false),
+		GitOpsLookup:         envBool("GITOPS_REVISION_LOOKUP", false),
+		ArgoCDNamespace:      os.Getenv("ARGOCD_NAMESPACE"),
+		Templates:            templates,
+	}
+	attributionWebhook := envBool("ATTRIBUTION_WEBHOOK", false)
+	if attributionWebhook {
+		lc.Attributions = &controller.AttributionStore{}
+	}
+
+	var watched []controller.WorkloadAdapter
+	for _, a := range adapters {
+		if envBool(a.envKey, true) {
+			watched = append(watched, a.adapter)
+		}
 	}
+	lc.Adapters = watched
 
 	for _, a := range adapters {
 		if !envBool(a.envKey, true) {
@@ -83,6 +176,8 @@ func main() {
 			Scheme:    mgr.GetScheme(),
 			Adapter:   a.adapter,
 			Lifecycle: lc,
+			APIReader: mgr.GetAPIReader(),
+			Deadline:  envDuration(a.deadlineKey, 0),
 		}
 		if err := r.SetupWithManager(mgr); err != nil {
 			logger.Error(err, "Failed to setup controller", "kind", a.adapter.Kind())
@@ -90,6 +185,44 @@ func main() {
 		}
 	}
 
+	if err := (&controller.NamespaceReconciler{
+		Client:    mgr.GetClient(),
+		Lifecycle: lc,
+	}).SetupWithManager(mgr); err != nil {
+		logger.Error(err, "Failed to setup namespace controller")
+		os.Exit(1)
+	}
+
+	if attributionWebhook {
+		(&controller.AttributionWebhook{
+			Client:   mgr.GetClient(),
+			Adapters: watched,
+			Store:    lc.Attributions,
+		}).SetupWithManager(mgr)
+		logger.Info("Attribution webhook enabled", "path", controller.AttributionWebhookPath)
+	}
+
+	if bursts != nil {
+		if err := mgr.Add(manager.RunnableFunc(lc.FlushBursts)); err != nil {
+			logger.Error(err, "Failed to register burst flushing")
+			os.Exit(1)
+		}
+	}
+
+	switch {
+	case lc.RolloutHistory > 0 && !metricsSecure:
+		logger.Info("Rollout history endpoint disabled: it is only served with METRICS_SECURE",
+			"path", controller.RolloutHistoryPath)
+	case lc.RolloutHistory > 0:
+		if err := mgr.AddMetricsServerExtraHandler(controller.RolloutHistoryPath, &controller.RolloutHistoryHandler{
+			Client:   mgr.GetClient(),
+			Adapters: watched,
+		}); err != nil {
+			logger.Error(err, "Failed to register rollout history endpoint")
+			os.Exit(1)
+		}
+	}
+
 	_ = mgr.AddHealthzCheck("healthz", func(*http.Request) error { return nil })
 	_ = mgr.AddReadyzCheck("readyz", func(*http.Request) error { return nil })
 
@@ -100,6 +233,61 @@ func main() {
 	}
 }
 
+// removeFinalizers releases every workload held by the deletion finalizer. It
+// runs as a Helm pre-delete hook. The controller Deployment named by
+// CONTROLLER_DEPLOYMENT ("namespace/name") is scaled to zero first, so it
+// cannot add the finalizers back.
+func removeFinalizers(scheme *runtime.Scheme) int {
+	logger := ctrl.Log.WithName("remove-finalizers")
+	ctx := ctrl.SetupSignalHandler()
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		logger.Error(err, "Failed to create client")
+		return 1
+	}
+	if ref := os.Getenv("CONTROLLER_DEPLOYMENT"); ref != "" {
+		if err := stopController(ctx, c, ref); err != nil {
+			logger.Error(err, "Failed to stop controller", "deployment", ref)
+			return 1
+		}
+	}
+	n, err := controller.RemoveDeletionFinalizers(ctx, c, []controller.WorkloadAdapter{
+		controller.DeploymentAdapter{}, controller.StatefulSetAdapter{}, controller.DaemonSetAdapter{},
+	})
+	if err != nil {
+		logger.Error(err, "Failed to remove deletion finalizers", "released", n)
+		return 1
+	}
+	logger.Info("Removed deletion finalizers", "workloads", n)
+	return 0
+}
+
+// stopController scales the Deployment ref ("namespace/name") to zero and
+// waits up to two minutes for its pods to stop.
+func stopController(ctx context.Context, c client.Client, ref string) error {
+	ns, name, ok := strings.Cut(ref, "/")
+	if !ok {
+		return fmt.Errorf("invalid deployment reference %q, want namespace/name", ref)
+	}
+	var d appsv1.Deployment
+	if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: name}, &d); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	patch := client.MergeFrom(d.DeepCopy())
+	d.Spec.Replicas = new(int32)
+	if err := c.Patch(ctx, &d, patch); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(2 * time.Minute)
+	for d.Status.Replicas > 0 && time.Now().Before(deadline) {
+		time.Sleep(2 * time.Second)
+		if err := c.Get(ctx, client.ObjectKeyFromObject(&d), &d); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+	}
+	return nil
+}
+
 func requireEnv(key string) string {
 	v := os.Getenv(key)
 	if v == "" {
@@ -109,6 +297,13 @@ func requireEnv(key string) string {
 	return v
 }
 
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
 func envBool(key string, def bool) bool {
 	if v := os.Getenv(key); v != "" {
 		if b, err := strconv.ParseBool(v); err == nil {
@@ -118,6 +313,39 @@ func envBool(key string, def bool) bool {
 	return def
 }
 
+// envList parses a comma-separated list, dropping empty items.
+func envList(key string, def []string) []string {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	out := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func envInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			return i
+		}
+	}
+	return def
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
+
 func zapOpts() []zap.Opts {
 	dev := envBool("LOG_DEVELOPMENT", false)
 	opts := []zap.Opts{zap.UseDevMode(dev)}